@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// ---------- Audit log ----------
+
+// Every scheduler action is appended to audit.jsonl in the state directory,
+// one JSON object per line: schedules created, moved and cancelled, every
+// GitHub call about a PR with its result, state transitions and
+// notifications. `pr-scheduler log` queries it.
+
+const auditFileName = "audit.jsonl"
+
+// auditEntry is one line of the audit log.
+type auditEntry struct {
+	Time    time.Time `json:"time"`
+	User    string    `json:"user,omitempty"` // GitHub login the action ran as
+	Source  string    `json:"source"`         // tui, cli or daemon
+	Repo    string    `json:"repo,omitempty"`
+	PR      int       `json:"pr,omitempty"`
+	HeadSHA string    `json:"head_sha,omitempty"`
+	// Action is schedule.created, schedule.rescheduled, schedule.cancelled,
+	// gh.<method> (e.g. gh.EnableAutoMerge), state or notify.<event>.
+	Action string `json:"action"`
+	Detail string `json:"detail,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// auditLog appends entries to the audit file. Auditing is best effort: a
+// failure to write never stops a merge.
+type auditLog struct {
+	mu     sync.Mutex
+	source string
+	user   string
+	// lookupUser resolves user the first time it is needed, unless setUser
+	// was called first. A single attempt is enough for a CLI command; the
+	// daemon looks its user up when it starts, see resolveDaemonUser.
+	lookupUser func() (string, error)
+	userOnce   sync.Once
+	shas       map[string]string // last known head SHA by PR ref
+}
+
+// audit is the process-wide audit log; main sets its source and user.
+var audit = &auditLog{source: "cli", shas: make(map[string]string)}
+
+// setSource names the process writing entries: tui, cli or daemon.
+func (a *auditLog) setSource(source string, lookupUser func() (string, error)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.source = source
+	a.lookupUser = lookupUser
+}
+
+// lookupAuditUser asks the configured backend who the user is.
+func lookupAuditUser() (string, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return "", err
+	}
+	return cfg.currentUser()
+}
+
+// setUser records the GitHub login, e.g. from fetchMeCmd.
+func (a *auditLog) setUser(login string) {
+	a.userOnce.Do(func() {})
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.user = login
+}
+
+// login returns the GitHub login entries are recorded with, "" until it is
+// known.
+func (a *auditLog) login() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.user
+}
+
+// noteSHA remembers the head commit of a PR for later entries about it.
+func (a *auditLog) noteSHA(p pr) {
+	if p.HeadSHA == "" {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.shas[p.ref()] = p.HeadSHA
+}
+
+func (a *auditLog) resolveUser() {
+	a.userOnce.Do(func() {
+		a.mu.Lock()
+		lookup := a.lookupUser
+		a.mu.Unlock()
+		if lookup == nil {
+			return
+		}
+		if login, err := lookup(); err == nil {
+			a.mu.Lock()
+			a.user = login
+			a.mu.Unlock()
+		}
+	})
+}
+
+// record appends an entry, filling in the time, user, source and, if it
+// is known, the PR's head SHA.
+func (a *auditLog) record(e auditEntry) {
+	a.resolveUser()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.User = a.user
+	e.Source = a.source
+	if e.HeadSHA == "" && e.PR != 0 {
+		e.HeadSHA = a.shas[pr{Repo: e.Repo, Number: e.PR}.ref()]
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	path, err := statePath(auditFileName)
+	if err != nil {
+		return
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	// A single write per line keeps concurrent writers from interleaving.
+	_, _ = f.Write(append(data, '\n'))
+}
+
+// recordSchedule records an action on a schedule.
+func (a *auditLog) recordSchedule(action string, s scheduledMerge, detail string) {
+	a.noteSHA(s.PR)
+	a.record(auditEntry{Repo: s.PR.Repo, PR: s.PR.Number, Action: action, Detail: detail})
+}
+
+// readAuditLog returns the entries accepted by keep, oldest first, and how
+// many lines it skipped because they are not entries, e.g. one cut short by
+// a crash.
+func readAuditLog(keep func(auditEntry) bool) (entries []auditEntry, skipped int, err error) {
+	path, err := statePath(auditFileName)
+	if err != nil {
+		return nil, 0, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for sc.Scan() {
+		var e auditEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil || e.Action == "" {
+			skipped++
+			continue
+		}
+		if keep(e) {
+			entries = append(entries, e)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return entries, skipped, nil
+}
+
+// ---------- Audited GitHub ----------
+
+// auditedGitHub records every call about a PR, with its result, in the
+// audit log.
+type auditedGitHub struct {
+	GitHub
+	repo string
+}
+
+func (g auditedGitHub) log(method string, number int, detail string, err error) {
+	e := auditEntry{Repo: g.repo, PR: number, Action: "gh." + method, Detail: detail}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	audit.record(e)
+}
+
+func (g auditedGitHub) GetPR(number int) (pr, error) {
+	p, err := g.GitHub.GetPR(number)
+	if err == nil {
+		audit.noteSHA(p)
+	}
+	g.log("GetPR", number, p.State, err)
+	return p, err
+}
+
+func (g auditedGitHub) PRState(number int) (string, error) {
+	state, err := g.GitHub.PRState(number)
+	g.log("PRState", number, state, err)
+	return state, err
+}
+
+func (g auditedGitHub) HeadSHA(number int) (string, error) {
+	sha, err := g.GitHub.HeadSHA(number)
+	if err == nil {
+		audit.noteSHA(pr{Repo: g.repo, Number: number, HeadSHA: sha})
+	}
+	g.log("HeadSHA", number, sha, err)
+	return sha, err
+}
+
+func (g auditedGitHub) Comment(number int, body string) error {
+	err := g.GitHub.Comment(number, body)
+	g.log("Comment", number, body, err)
+	return err
+}
+
+func (g auditedGitHub) EnableAutoMerge(number int, method mergeMethod, headSHA string) error {
+	err := g.GitHub.EnableAutoMerge(number, method, headSHA)
+	detail := method.label()
+	if headSHA != "" {
+		detail += " at " + headSHA
+	}
+	g.log("EnableAutoMerge", number, detail, err)
+	return err
+}
+
+func (g auditedGitHub) DisableAutoMerge(number int) error {
+	err := g.GitHub.DisableAutoMerge(number)
+	g.log("DisableAutoMerge", number, "", err)
+	return err
+}
+
+func (g auditedGitHub) SetBase(number int, base string) error {
+	err := g.GitHub.SetBase(number, base)
+	g.log("SetBase", number, base, err)
+	return err
+}
+
+func (g auditedGitHub) UpdateBranch(number int, rebase bool) error {
+	err := g.GitHub.UpdateBranch(number, rebase)
+	detail := "merge"
+	if rebase {
+		detail = "rebase"
+	}
+	g.log("UpdateBranch", number, detail, err)
+	return err
+}
+
+func (g auditedGitHub) CheckStatus(number int) (checksResult, error) {
+	checks, err := g.GitHub.CheckStatus(number)
+	g.log("CheckStatus", number, checks.State, err)
+	return checks, err
+}
+
+func (g auditedGitHub) ReviewDecision(number int) (string, error) {
+	decision, err := g.GitHub.ReviewDecision(number)
+	g.log("ReviewDecision", number, decision, err)
+	return decision, err
+}
+
+func (g auditedGitHub) PRDetails(number int) (prDetails, error) {
+	d, err := g.GitHub.PRDetails(number)
+	if err == nil {
+		audit.noteSHA(d.PR)
+	}
+	g.log("PRDetails", number, d.PR.State, err)
+	return d, err
+}
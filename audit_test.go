@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeAuditLog writes lines to the audit log of a fresh state directory.
+func writeAuditLog(t *testing.T, lines ...string) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", dir)
+	if err := os.MkdirAll(filepath.Join(dir, "pr-scheduler"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	data := strings.Join(lines, "\n") + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "pr-scheduler", auditFileName), []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func auditLine(t *testing.T, e auditEntry) string {
+	t.Helper()
+	data, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// seedAuditLog writes a log of a PR being scheduled and merged, with a line
+// cut short in the middle.
+func seedAuditLog(t *testing.T) {
+	t.Helper()
+	now := time.Now()
+	writeAuditLog(t,
+		auditLine(t, auditEntry{Time: now.Add(-72 * time.Hour), User: "alice", Source: "tui", Repo: "acme/app", PR: 1, Action: "schedule.created"}),
+		auditLine(t, auditEntry{Time: now.Add(-2 * time.Hour), User: "alice", Source: "daemon", Repo: "acme/app", PR: 1, HeadSHA: "abc1234567", Action: "gh.EnableAutoMerge", Detail: "squash"}),
+		`{"time":"2026-10-14T10:00:00Z","user":"ali`,
+		auditLine(t, auditEntry{Time: now.Add(-time.Hour), User: "bob", Source: "cli", Repo: "acme/app", PR: 2, Action: "schedule.cancelled"}),
+		"",
+		auditLine(t, auditEntry{Time: now.Add(-30 * time.Minute), Source: "daemon", Repo: "acme/other", PR: 1, Action: "state", Detail: "pending -> commenting: Posting comment"}),
+	)
+}
+
+func TestReadAuditLog(t *testing.T) {
+	seedAuditLog(t)
+	entries, skipped, err := readAuditLog(func(e auditEntry) bool { return e.Source == "daemon" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skipped != 2 {
+		t.Errorf("skipped %d lines, want the cut one and the empty one", skipped)
+	}
+	var actions []string
+	for _, e := range entries {
+		actions = append(actions, e.Action)
+	}
+	if want := []string{"gh.EnableAutoMerge", "state"}; !slices.Equal(actions, want) {
+		t.Errorf("actions = %v, want %v", actions, want)
+	}
+
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	if entries, skipped, err := readAuditLog(func(auditEntry) bool { return true }); entries != nil || skipped != 0 || err != nil {
+		t.Errorf("without a log = %v, %d, %v", entries, skipped, err)
+	}
+}
+
+func TestLogCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string // actions, oldest first
+	}{
+		{"everything", nil, []string{"schedule.created", "gh.EnableAutoMerge", "schedule.cancelled", "state"}},
+		{"PR in any repository", []string{"1"}, []string{"schedule.created", "gh.EnableAutoMerge", "state"}},
+		{"PR", []string{"acme/app#1"}, []string{"schedule.created", "gh.EnableAutoMerge"}},
+		{"repository", []string{"--repo", "acme/other"}, []string{"state"}},
+		{"since", []string{"--since", "1d"}, []string{"gh.EnableAutoMerge", "schedule.cancelled", "state"}},
+		{"time range", []string{"--since", "90m", "--until", "45m"}, []string{"schedule.cancelled"}},
+		{"source", []string{"--source", "daemon"}, []string{"gh.EnableAutoMerge", "state"}},
+		{"user", []string{"--user", "@Alice"}, []string{"schedule.created", "gh.EnableAutoMerge"}},
+		{"source and user", []string{"--source", "cli", "--user", "alice"}, nil},
+		{"PR and source", []string{"acme/app#1", "--source", "tui"}, []string{"schedule.created"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seedAuditLog(t)
+			code, out := runCLI(t, "log", append([]string{"--json"}, tt.args...)...)
+			if code != exitOK {
+				t.Fatalf("log = %d", code)
+			}
+			var actions []string
+			for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+				if line == "" {
+					continue
+				}
+				var e auditEntry
+				if err := json.Unmarshal([]byte(line), &e); err != nil {
+					t.Fatalf("%v in %q", err, line)
+				}
+				actions = append(actions, e.Action)
+			}
+			if !slices.Equal(actions, tt.want) {
+				t.Errorf("log %v = %v, want %v", tt.args, actions, tt.want)
+			}
+		})
+	}
+
+	seedAuditLog(t)
+	code, out := runCLI(t, "log", "acme/app#1")
+	if code != exitOK {
+		t.Fatalf("log = %d", code)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "TIME") {
+		t.Fatalf("log printed %q", out)
+	}
+	for _, want := range []string{"alice", "daemon", "acme/app#1", "abc1234", "gh.EnableAutoMerge", "squash"} {
+		if !strings.Contains(lines[2], want) {
+			t.Errorf("%q does not show %q", lines[2], want)
+		}
+	}
+
+	for _, args := range [][]string{{"--source", "web"}, {"--since", "soon"}, {"1", "2"}} {
+		if code, _ := runCLI(t, "log", args...); code != exitUsage {
+			t.Errorf("log %v = %d, want %d", args, code, exitUsage)
+		}
+	}
+}
+
+func TestParseLogTime(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{in: "today", want: localTime(2026, 10, 14, 0, 0)},
+		{in: "Yesterday", want: localTime(2026, 10, 13, 0, 0)},
+		{in: "2026-10-12", want: localTime(2026, 10, 12, 0, 0)},
+		{in: "2026-10-12 09:30", want: localTime(2026, 10, 12, 9, 30)},
+		{in: "2026-10-12T09:30:00Z", want: time.Date(2026, 10, 12, 9, 30, 0, 0, time.UTC)},
+		{in: "90m", want: parseNow.Add(-90 * time.Minute)},
+		{in: "2h", want: parseNow.Add(-2 * time.Hour)},
+		{in: "2d", want: parseNow.AddDate(0, 0, -2)},
+		{in: "1d 12h", want: parseNow.Add(-36 * time.Hour)},
+		{in: "someday", wantErr: true},
+		{in: "-2h", wantErr: true},
+		{in: "2026-10-12 9", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseLogTime(tt.in, parseNow)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseLogTime(%q) = %s, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("parseLogTime(%q) = %s, %v, want %s", tt.in, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,766 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// ---------- CLI subcommands ----------
+
+// Exit codes of the non-interactive subcommands, meant to be checked by
+// scripts and CI jobs.
+const (
+	exitOK       = 0
+	exitError    = 1 // gh, daemon or state file failure
+	exitUsage    = 2 // invalid arguments
+	exitNotFound = 3 // no matching schedule
+)
+
+const cliUsage = `Usage:
+  pr-scheduler [--repo owner/name]... [--dry-run]
+                                               interactive TUI
+  pr-scheduler daemon [--dry-run]              run the scheduler without the TUI
+  pr-scheduler schedule <pr> [--at <time>] [--method merge|squash|rebase]
+                        [--after <pr>]... [--stack] [--gate]
+                        [--update-branch merge|rebase|off]
+                        [--give-up-after <duration>] [--dry-run]
+                                               schedule an auto-merge (default: now,
+                                               with the repo's configured method),
+                                               once the --after PRs have merged;
+                                               --stack merges the PR's whole stack
+                                               bottom-up; --gate waits for green
+                                               checks and an approving review;
+                                               --update-branch brings a PR that
+                                               is behind its base up to date;
+                                               --give-up-after bounds how long
+                                               the merge is verified (e.g. 2h);
+                                               --dry-run only logs the comments,
+                                               auto-merge and branch changes it
+                                               would make
+  pr-scheduler list [--active]                 list scheduled merges
+  pr-scheduler cancel <pr>                     cancel an active scheduled merge
+  pr-scheduler status [<pr>] [--json]          show schedule details
+  pr-scheduler log [<pr>] [--since <time>] [--until <time>]
+                   [--source tui|cli|daemon] [--user <login>] [--json]
+                                               show the audit log of every
+                                               scheduler action, e.g.
+                                               --since 2d or --since today
+
+A <pr> is a number in the current repository (or the one given with
+--repo owner/name), or a full reference like my-org/api#123.
+
+Times are local: "now", "YYYY-MM-DD HH:MM", "+90m", "17:30", "tomorrow 9am",
+"fri 16:00" or "next monday 10:00".
+
+Exit codes: 0 ok, 1 error, 2 invalid arguments, 3 no matching schedule.
+`
+
+// runCommand runs a subcommand and returns the process exit code.
+func runCommand(name string, args []string) int {
+	switch name {
+	case "daemon":
+		audit.setSource("daemon", nil) // the daemon resolves its user on start
+		return runDaemonCommand(args)
+	case "schedule":
+		return runScheduleCommand(args)
+	case "list":
+		return runListCommand(args)
+	case "cancel":
+		return runCancelCommand(args)
+	case "status":
+		return runStatusCommand(args)
+	case "log":
+		return runLogCommand(args)
+	case "help", "-h", "--help":
+		fmt.Print(cliUsage)
+		return exitOK
+	}
+	fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", name, cliUsage)
+	return exitUsage
+}
+
+// parseArgs parses flags that may appear before or after the positional
+// arguments (`schedule 123 --at ...` as well as `schedule --at ... 123`).
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+func usageError(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Print(cliUsage)
+		return exitOK
+	}
+	fmt.Fprintf(os.Stderr, "Error: %v\n\n%s", err, cliUsage)
+	return exitUsage
+}
+
+func parsePRNumber(arg string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimPrefix(arg, "#"))
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid PR number %q", arg)
+	}
+	return n, nil
+}
+
+// parsePRArg parses a PR argument: "123", "#123" or "owner/name#123". The
+// repository comes from the argument if given, else from repoFlag (which may
+// be empty).
+func parsePRArg(arg, repoFlag string) (repo string, number int, err error) {
+	repo = repoFlag
+	if r, n, ok := strings.Cut(arg, "#"); ok && r != "" {
+		repo, arg = r, n
+	}
+	if repo != "" {
+		if err := validateRepo(repo); err != nil {
+			return "", 0, err
+		}
+	}
+	number, err = parsePRNumber(arg)
+	return repo, number, err
+}
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// repoList is a repeatable --repo flag.
+type repoList []string
+
+func (r *repoList) String() string { return strings.Join(*r, ",") }
+
+func (r *repoList) Set(repo string) error {
+	if err := validateRepo(repo); err != nil {
+		return err
+	}
+	*r = append(*r, repo)
+	return nil
+}
+
+// parseRootArgs parses the flags of the TUI invocation.
+func parseRootArgs(args []string) (repos []string, dryRun bool, err error) {
+	fs := newFlagSet("pr-scheduler")
+	var list repoList
+	fs.Var(&list, "repo", "repository to list, repeatable")
+	fs.BoolVar(&dryRun, "dry-run", false, "schedule dry runs that only log the calls that would change PRs")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(positional) != 0 {
+		return nil, false, fmt.Errorf("unexpected argument %q", positional[0])
+	}
+	return list, dryRun, nil
+}
+
+func runScheduleCommand(args []string) int {
+	fs := newFlagSet("schedule")
+	at := fs.String("at", "now", "merge time")
+	methodFlag := fs.String("method", "", "merge method: merge, squash or rebase")
+	repoFlag := fs.String("repo", "", "repository (owner/name)")
+	var after stringList
+	fs.Var(&after, "after", "PR that has to merge first, repeatable")
+	stack := fs.Bool("stack", false, "schedule the whole stack of the PR, bottom-up")
+	gateFlag := fs.Bool("gate", false, "wait for checks and an approving review before merging")
+	updateFlag := fs.String("update-branch", "", "update the branch when it is behind: merge, rebase or off")
+	giveUpAfter := fs.Duration("give-up-after", 0, "how long to verify the merge before giving up (default from the config)")
+	dryRun := fs.Bool("dry-run", false, "only log the calls that would change the PR")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return usageError(err)
+	}
+	if len(positional) != 1 {
+		return usageError(errors.New("schedule takes exactly one PR number"))
+	}
+	if _, err := parseUpdateBranch(*updateFlag); err != nil {
+		return usageError(err)
+	}
+	if *giveUpAfter < 0 {
+		return usageError(errors.New("--give-up-after must be positive"))
+	}
+	if *stack && len(after) > 0 {
+		return usageError(errors.New("--stack and --after cannot be combined"))
+	}
+	repo, prNumber, err := parsePRArg(positional[0], *repoFlag)
+	if err != nil {
+		return usageError(err)
+	}
+	when, err := parseScheduleTime(*at, time.Now())
+	if err != nil {
+		return usageError(fmt.Errorf("invalid time: %w", err))
+	}
+	method, err := parseMergeMethod(*methodFlag)
+	if err != nil {
+		return usageError(err)
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitError
+	}
+	if repo == "" {
+		// No repository given: use the one of the working directory.
+		if repo, err = cfg.newGitHub("").Repo(); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return exitError
+		}
+	}
+	if method == "" {
+		method = cfg.mergeMethodFor(repo)
+	}
+	update := cfg.updateBranchFor(repo)
+	if *updateFlag != "" {
+		update, _ = parseUpdateBranch(*updateFlag)
+	}
+	// --gate (or --gate=false) overrides the config.
+	gate := cfg.gateFor(repo)
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "gate" {
+			gate = *gateFlag
+		}
+	})
+	freeze, err := cfg.freezePolicy()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitError
+	}
+	when, message, err := freeze.check(when)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: cannot schedule:", err)
+		return exitError
+	}
+
+	gh := cfg.newGitHub(repo)
+	p, err := gh.GetPR(prNumber)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitError
+	}
+	if p.HeadSHA == "" {
+		fmt.Fprintf(os.Stderr, "Error: failed to look up the head commit of PR %s\n", p.ref())
+		return exitError
+	}
+	if *stack {
+		return scheduleStackCommand(gh, p, when, method, scheduleOptions{gate: gate, updateBranch: update, verifyTimeout: *giveUpAfter, dryRun: *dryRun}, message)
+	}
+	// Dependencies default to the repository of the PR.
+	var deps []dependency
+	for _, arg := range after {
+		depRepo, depNumber, err := parsePRArg(arg, repo)
+		if err != nil {
+			return usageError(err)
+		}
+		if depRepo == p.Repo && depNumber == p.Number {
+			return usageError(errors.New("a PR cannot depend on itself"))
+		}
+		dep, err := cfg.newGitHub(depRepo).GetPR(depNumber)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return exitError
+		}
+		deps = append(deps, dependency{PR: dep})
+	}
+	if err := addSchedule(scheduledMerge{PR: p, When: when, MergeMethod: method, DependsOn: deps, Gate: gate, UpdateBranch: update, VerifyTimeout: *giveUpAfter, DryRun: *dryRun, HeadSHA: p.HeadSHA, LastMessage: message}); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitError
+	}
+	fmt.Printf("Scheduled auto-merge (%s) for PR %s at %s\n", method, p.ref(), when.Format("2006-01-02 15:04"))
+	for _, d := range deps {
+		fmt.Printf("  after %s %s\n", d.PR.ref(), d.PR.Title)
+	}
+	if gate {
+		fmt.Println("  once checks passed and the PR is approved")
+	}
+	if update != "" {
+		fmt.Printf("  updating the branch (%s) when it is behind\n", update)
+	}
+	if p.HeadSHA != "" {
+		fmt.Printf("  only at commit %s; new commits hold the merge until re-confirmed\n", shortSHA(p.HeadSHA))
+	}
+	if *dryRun {
+		fmt.Println("  dry run: no comments are posted and auto-merge is not enabled")
+	}
+	if message != "" {
+		fmt.Println(message)
+	}
+	return ensureDaemon()
+}
+
+// scheduleOptions are the per-schedule settings of `schedule`.
+type scheduleOptions struct {
+	gate          bool
+	updateBranch  string
+	verifyTimeout time.Duration
+	dryRun        bool
+}
+
+// scheduleStackCommand schedules the whole stack p belongs to.
+func scheduleStackCommand(gh GitHub, p pr, when time.Time, method mergeMethod, opts scheduleOptions, message string) int {
+	prs, err := gh.ListPRs()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitError
+	}
+	stack := stackOf(prs, p)
+	if len(stack) < 2 {
+		fmt.Fprintf(os.Stderr, "Error: PR %s is not part of a stack\n", p.ref())
+		return exitError
+	}
+	if stack, err = freshHeads(func(string) GitHub { return gh }, stack); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitError
+	}
+	scheduled := stackSchedules(stack, when, method)
+	for i := range scheduled {
+		scheduled[i].Gate = opts.gate
+		scheduled[i].UpdateBranch = opts.updateBranch
+		scheduled[i].VerifyTimeout = opts.verifyTimeout
+		scheduled[i].DryRun = opts.dryRun
+		scheduled[i].LastMessage = message
+	}
+	if err := addSchedules(scheduled); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitError
+	}
+	fmt.Printf("Scheduled auto-merge (%s) for a stack of %d PRs at %s\n", method, len(stack), when.Format("2006-01-02 15:04"))
+	for _, s := range scheduled {
+		fmt.Printf("  %s %s (%s)\n", s.PR.ref(), s.PR.Title, s.PR.HeadRef)
+	}
+	if message != "" {
+		fmt.Println(message)
+	}
+	return ensureDaemon()
+}
+
+// ensureDaemon starts the daemon unless one is already running.
+func ensureDaemon() int {
+	if !daemonRunning() {
+		pid, err := startDaemon()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return exitError
+		}
+		fmt.Fprintf(os.Stderr, "Started scheduler daemon (pid %d)\n", pid)
+	}
+	return exitOK
+}
+
+func runListCommand(args []string) int {
+	fs := newFlagSet("list")
+	activeOnly := fs.Bool("active", false, "only show schedules that have not finished")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return usageError(err)
+	}
+	if len(positional) != 0 {
+		return usageError(errors.New("list takes no arguments"))
+	}
+
+	scheduled, err := loadSchedules()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitError
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PR\tWHEN\tMETHOD\tSTATE\tTITLE\tMESSAGE")
+	for _, s := range scheduled {
+		if *activeOnly && s.done() {
+			continue
+		}
+		state := s.stateLabel()
+		if s.DryRun {
+			state += " (dry run)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			s.PR.ref(),
+			s.When.Format("2006-01-02 15:04"),
+			s.MergeMethod.label(),
+			state,
+			s.PR.Title,
+			s.LastMessage,
+		)
+	}
+	if err := w.Flush(); err != nil {
+		return exitError
+	}
+	return exitOK
+}
+
+// matchesPR reports whether a schedule is for the given PR. An empty repo
+// matches the number in any repository.
+func matchesPR(s scheduledMerge, repo string, number int) bool {
+	return s.PR.Number == number && (repo == "" || s.PR.Repo == repo)
+}
+
+func runCancelCommand(args []string) int {
+	fs := newFlagSet("cancel")
+	repoFlag := fs.String("repo", "", "repository (owner/name)")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return usageError(err)
+	}
+	if len(positional) != 1 {
+		return usageError(errors.New("cancel takes exactly one PR number"))
+	}
+	repo, prNumber, err := parsePRArg(positional[0], *repoFlag)
+	if err != nil {
+		return usageError(err)
+	}
+
+	if repo == "" {
+		// No repository given: accept the number if it is unambiguous.
+		scheduled, err := loadSchedules()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return exitError
+		}
+		for _, s := range scheduled {
+			if s.done() || !matchesPR(s, "", prNumber) {
+				continue
+			}
+			if repo != "" {
+				return usageError(fmt.Errorf("PR #%d is scheduled in several repositories, use --repo or owner/name#%d", prNumber, prNumber))
+			}
+			repo = s.PR.Repo
+		}
+	}
+
+	cancelled, found, err := cancelSchedule(repo, prNumber, time.Now())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitError
+	}
+	if !found {
+		fmt.Fprintf(os.Stderr, "No active scheduled merge for PR #%d\n", prNumber)
+		return exitNotFound
+	}
+
+	// Auto-merge was already requested on GitHub; switch it off again.
+	if cancelled.autoMergeRequested() {
+		cfg, err := loadConfig()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return exitError
+		}
+		gh := cfg.newGitHub(cancelled.PR.Repo)
+		if cancelled.DryRun {
+			gh = dryRunGitHub{GitHub: gh, repo: cancelled.PR.Repo, logf: func(format string, args ...any) {
+				fmt.Printf(format+"\n", args...)
+			}}
+		}
+		if err := gh.DisableAutoMerge(prNumber); err != nil {
+			fmt.Fprintf(os.Stderr, "Cancelled, but failed to disable auto-merge: %v\n", err)
+			return exitError
+		}
+	}
+	fmt.Printf("Cancelled scheduled merge for PR %s\n", cancelled.PR.ref())
+	return exitOK
+}
+
+// scheduleStatus is the stable JSON shape printed by `status --json`.
+type scheduleStatus struct {
+	Repo         string    `json:"repo"`
+	PR           int       `json:"pr"`
+	Title        string    `json:"title"`
+	URL          string    `json:"url"`
+	When         time.Time `json:"when"`
+	MergeMethod  string    `json:"merge_method"`
+	DependsOn    []string  `json:"depends_on"`
+	Gate         bool      `json:"gate"`
+	UpdateBranch string    `json:"update_branch"`
+	DryRun       bool      `json:"dry_run"`
+	HeadSHA      string    `json:"head_sha"`
+	// Set when commits were pushed after scheduling; the merge waits for
+	// re-confirmation in the TUI.
+	NewHeadSHA string `json:"new_head_sha,omitempty"`
+	// Why the PR may not merge as it is, e.g. "PR is a draft".
+	Warning string `json:"warning,omitempty"`
+	State   string `json:"state"`
+	// Lifecycle is the state machine's state, e.g. awaiting_merge.
+	Lifecycle scheduleState `json:"lifecycle"`
+	// Set while the merge is being verified.
+	CheckAttempts  int             `json:"check_attempts"`
+	VerifyDeadline *time.Time      `json:"verify_deadline,omitempty"`
+	Done           bool            `json:"done"`
+	FinishedAt     *time.Time      `json:"finished_at,omitempty"`
+	LastMessage    string          `json:"last_message"`
+	History        []historyStatus `json:"history"`
+}
+
+type historyStatus struct {
+	At    time.Time `json:"at"`
+	Event string    `json:"event"`
+	// Set when the event moved the schedule to another state.
+	From scheduleState `json:"from,omitempty"`
+	To   scheduleState `json:"to,omitempty"`
+}
+
+func newScheduleStatus(s scheduledMerge) scheduleStatus {
+	st := scheduleStatus{
+		Repo:          s.PR.Repo,
+		PR:            s.PR.Number,
+		Title:         s.PR.Title,
+		URL:           s.PR.URL,
+		When:          s.When,
+		MergeMethod:   s.MergeMethod.label(),
+		DependsOn:     s.dependencyRefs(),
+		Gate:          s.Gate,
+		UpdateBranch:  s.UpdateBranch,
+		DryRun:        s.DryRun,
+		HeadSHA:       s.HeadSHA,
+		NewHeadSHA:    s.NewHeadSHA,
+		Warning:       s.Warning,
+		State:         s.stateLabel(),
+		Lifecycle:     s.State,
+		CheckAttempts: s.CheckAttempts,
+		Done:          s.done(),
+		LastMessage:   s.LastMessage,
+		History:       []historyStatus{},
+	}
+	for _, h := range s.History {
+		st.History = append(st.History, historyStatus{At: h.At, Event: h.Event, From: h.From, To: h.To})
+	}
+	if s.verifying() && !s.VerifyDeadline.IsZero() {
+		deadline := s.VerifyDeadline
+		st.VerifyDeadline = &deadline
+	}
+	if s.done() {
+		finishedAt := s.FinishedAt
+		st.FinishedAt = &finishedAt
+	}
+	return st
+}
+
+func runStatusCommand(args []string) int {
+	fs := newFlagSet("status")
+	asJSON := fs.Bool("json", false, "print JSON")
+	repoFlag := fs.String("repo", "", "only show this repository (owner/name)")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return usageError(err)
+	}
+	if len(positional) > 1 {
+		return usageError(errors.New("status takes at most one PR number"))
+	}
+	repo, prNumber := *repoFlag, 0
+	if repo != "" {
+		if err := validateRepo(repo); err != nil {
+			return usageError(err)
+		}
+	}
+	if len(positional) == 1 {
+		if repo, prNumber, err = parsePRArg(positional[0], repo); err != nil {
+			return usageError(err)
+		}
+	}
+
+	scheduled, err := loadSchedules()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitError
+	}
+
+	statuses := []scheduleStatus{}
+	for _, s := range scheduled {
+		if repo != "" && s.PR.Repo != repo {
+			continue
+		}
+		if prNumber == 0 || s.PR.Number == prNumber {
+			statuses = append(statuses, newScheduleStatus(s))
+		}
+	}
+	if prNumber != 0 && len(statuses) == 0 {
+		fmt.Fprintf(os.Stderr, "No scheduled merge for PR #%d\n", prNumber)
+		return exitNotFound
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(statuses); err != nil {
+			return exitError
+		}
+		return exitOK
+	}
+
+	for i, st := range statuses {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("PR %s#%d %s\n", st.Repo, st.PR, st.Title)
+		fmt.Printf("  URL:     %s\n", st.URL)
+		fmt.Printf("  When:    %s\n", st.When.Format("2006-01-02 15:04"))
+		fmt.Printf("  Method:  %s\n", st.MergeMethod)
+		if len(st.DependsOn) > 0 {
+			fmt.Printf("  After:   %s\n", strings.Join(st.DependsOn, ", "))
+		}
+		if st.Gate {
+			fmt.Println("  Gate:    checks and review")
+		}
+		if st.UpdateBranch != "" {
+			fmt.Printf("  Update:  %s when behind\n", st.UpdateBranch)
+		}
+		if st.VerifyDeadline != nil {
+			fmt.Printf("  Verify:  %d checks, until %s\n", st.CheckAttempts, st.VerifyDeadline.Format("2006-01-02 15:04"))
+		}
+		if st.DryRun {
+			fmt.Println("  Dry run: calls that would change the PR are only logged")
+		}
+		if st.HeadSHA != "" {
+			fmt.Printf("  Commit:  %s\n", shortSHA(st.HeadSHA))
+		}
+		if st.NewHeadSHA != "" {
+			fmt.Printf("  Pushed:  %s, re-confirm in the TUI (a) to merge it\n", shortSHA(st.NewHeadSHA))
+		}
+		if st.Warning != "" && !st.Done {
+			fmt.Printf("  Warning: %s\n", st.Warning)
+		}
+		fmt.Printf("  State:   %s\n", st.State)
+		if st.FinishedAt != nil {
+			fmt.Printf("  Ended:   %s\n", st.FinishedAt.Format("2006-01-02 15:04"))
+		}
+		if st.LastMessage != "" {
+			fmt.Printf("  Message: %s\n", st.LastMessage)
+		}
+		if len(st.History) > 0 {
+			fmt.Println("  History:")
+			for _, h := range st.History {
+				if h.To != "" {
+					fmt.Printf("    %s [%s] %s\n", h.At.Format("2006-01-02 15:04:05"), h.To, h.Event)
+					continue
+				}
+				fmt.Printf("    %s %s\n", h.At.Format("2006-01-02 15:04:05"), h.Event)
+			}
+		}
+	}
+	return exitOK
+}
+
+func runLogCommand(args []string) int {
+	fs := newFlagSet("log")
+	asJSON := fs.Bool("json", false, "print JSON lines")
+	repoFlag := fs.String("repo", "", "only show this repository (owner/name)")
+	sinceFlag := fs.String("since", "", "only show entries from this time on")
+	untilFlag := fs.String("until", "", "only show entries before this time")
+	source := fs.String("source", "", "only show entries from tui, cli or daemon")
+	user := fs.String("user", "", "only show entries of this GitHub login")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return usageError(err)
+	}
+	if len(positional) > 1 {
+		return usageError(errors.New("log takes at most one PR number"))
+	}
+	switch *source {
+	case "", "tui", "cli", "daemon":
+	default:
+		return usageError(fmt.Errorf("invalid source %q (want tui, cli or daemon)", *source))
+	}
+	repo, prNumber := *repoFlag, 0
+	if repo != "" {
+		if err := validateRepo(repo); err != nil {
+			return usageError(err)
+		}
+	}
+	if len(positional) == 1 {
+		if repo, prNumber, err = parsePRArg(positional[0], repo); err != nil {
+			return usageError(err)
+		}
+	}
+	now := time.Now()
+	var since, until time.Time
+	if *sinceFlag != "" {
+		if since, err = parseLogTime(*sinceFlag, now); err != nil {
+			return usageError(err)
+		}
+	}
+	if *untilFlag != "" {
+		if until, err = parseLogTime(*untilFlag, now); err != nil {
+			return usageError(err)
+		}
+	}
+
+	login := strings.TrimPrefix(*user, "@")
+	entries, skipped, err := readAuditLog(func(e auditEntry) bool {
+		return (repo == "" || e.Repo == repo) &&
+			(prNumber == 0 || e.PR == prNumber) &&
+			(since.IsZero() || !e.Time.Before(since)) &&
+			(until.IsZero() || e.Time.Before(until)) &&
+			(*source == "" || e.Source == *source) &&
+			(login == "" || strings.EqualFold(e.User, login))
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitError
+	}
+	if skipped > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: skipped %d malformed lines of the audit log\n", skipped)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		for _, e := range entries {
+			if err := enc.Encode(e); err != nil {
+				return exitError
+			}
+		}
+		return exitOK
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tUSER\tSOURCE\tPR\tSHA\tACTION\tDETAIL")
+	for _, e := range entries {
+		ref := ""
+		if e.PR != 0 {
+			ref = pr{Repo: e.Repo, Number: e.PR}.ref()
+		}
+		detail := strings.ReplaceAll(e.Detail, "\n", " ")
+		if e.Error != "" {
+			detail = strings.TrimSpace(detail + " error: " + strings.ReplaceAll(e.Error, "\n", " "))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			e.Time.In(time.Local).Format("2006-01-02 15:04:05"),
+			e.User,
+			e.Source,
+			ref,
+			shortSHA(e.HeadSHA),
+			e.Action,
+			detail,
+		)
+	}
+	if err := w.Flush(); err != nil {
+		return exitError
+	}
+	return exitOK
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// captureOutput runs f with os.Stdout redirected and returns what it printed.
+// Whatever f prints to os.Stderr is dropped.
+func captureOutput(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = w, devNull
+	defer func() {
+		os.Stdout, os.Stderr = stdout, stderr
+		devNull.Close()
+	}()
+
+	out := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		out <- string(data)
+	}()
+	f()
+	w.Close()
+	return <-out
+}
+
+// runCLI runs a subcommand and returns its exit code and standard output.
+func runCLI(t *testing.T, name string, args ...string) (int, string) {
+	t.Helper()
+	var code int
+	out := captureOutput(t, func() { code = runCommand(name, args) })
+	return code, out
+}
+
+// seedSchedules writes a state file with a pending schedule for acme/app#1
+// and a merged one for acme/app#2.
+func seedSchedules(t *testing.T) {
+	t.Helper()
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	now := time.Now()
+	pending := scheduledMerge{
+		PR:          pr{Repo: "acme/app", Number: 1, Title: "Add login", URL: "https://github.com/acme/app/pull/1"},
+		When:        now.Add(time.Hour),
+		MergeMethod: mergeMethodSquash,
+		HeadSHA:     "abc123",
+	}
+	pending.transition(now, statePending, "Scheduled")
+	merged := scheduledMerge{
+		PR:          pr{Repo: "acme/app", Number: 2, Title: "Fix logout"},
+		When:        now.Add(-time.Hour),
+		MergeMethod: mergeMethodMerge,
+	}
+	merged.transition(now, statePending, "Scheduled")
+	merged.transition(now, stateMerged, "PR is merged")
+	if err := saveSchedules([]scheduledMerge{pending, merged}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCommandExitCodes(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		args    []string
+		want    int
+	}{
+		{"help", "help", nil, exitOK},
+		{"unknown command", "frobnicate", nil, exitUsage},
+		{"list", "list", nil, exitOK},
+		{"list with an argument", "list", []string{"1"}, exitUsage},
+		{"unknown flag", "list", []string{"--all"}, exitUsage},
+		{"status", "status", nil, exitOK},
+		{"status of a PR", "status", []string{"acme/app#1"}, exitOK},
+		{"status of an unscheduled PR", "status", []string{"7"}, exitNotFound},
+		{"status of an invalid PR", "status", []string{"seven"}, exitUsage},
+		{"status of an invalid repository", "status", []string{"--repo", "acme", "1"}, exitUsage},
+		{"cancel without a PR", "cancel", nil, exitUsage},
+		{"cancel an unscheduled PR", "cancel", []string{"7"}, exitNotFound},
+		{"cancel a merged PR", "cancel", []string{"2"}, exitNotFound},
+		{"schedule without a PR", "schedule", nil, exitUsage},
+		{"schedule at an invalid time", "schedule", []string{"1", "--at", "someday"}, exitUsage},
+		{"schedule with an invalid method", "schedule", []string{"1", "--method", "octopus"}, exitUsage},
+		{"schedule a stack after a PR", "schedule", []string{"1", "--stack", "--after", "2"}, exitUsage},
+		{"log", "log", nil, exitOK},
+		{"log since an invalid time", "log", []string{"--since", "someday"}, exitUsage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seedSchedules(t)
+			if got, _ := runCLI(t, tt.command, tt.args...); got != tt.want {
+				t.Errorf("%s %v = %d, want %d", tt.command, tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommandsFailOnABrokenStateFile(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", dir)
+	if err := os.MkdirAll(filepath.Join(dir, "pr-scheduler"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "pr-scheduler", stateFileName), []byte("{not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{{"list"}, {"status"}, {"cancel", "1"}} {
+		if got, _ := runCLI(t, args[0], args[1:]...); got != exitError {
+			t.Errorf("%v = %d, want %d", args, got, exitError)
+		}
+	}
+}
+
+func TestCancelCommand(t *testing.T) {
+	seedSchedules(t)
+	code, out := runCLI(t, "cancel", "1")
+	if code != exitOK || !strings.Contains(out, "Cancelled scheduled merge for PR acme/app#1") {
+		t.Fatalf("cancel = %d %q", code, out)
+	}
+	scheduled, err := loadSchedules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scheduled[0].State != stateCancelled {
+		t.Errorf("state = %s, want %s", scheduled[0].State, stateCancelled)
+	}
+	// Cancelling again finds no active schedule.
+	if code, _ := runCLI(t, "cancel", "1"); code != exitNotFound {
+		t.Errorf("second cancel = %d, want %d", code, exitNotFound)
+	}
+}
+
+func TestStatusJSON(t *testing.T) {
+	seedSchedules(t)
+	code, out := runCLI(t, "status", "--json")
+	if code != exitOK {
+		t.Fatalf("status --json = %d", code)
+	}
+	var statuses []map[string]any
+	if err := json.Unmarshal([]byte(out), &statuses); err != nil {
+		t.Fatalf("%v in %s", err, out)
+	}
+	if len(statuses) != 2 {
+		t.Fatalf("got %d statuses, want 2", len(statuses))
+	}
+
+	pending := statuses[0]
+	for _, key := range []string{
+		"repo", "pr", "title", "url", "when", "merge_method", "depends_on", "gate",
+		"update_branch", "dry_run", "head_sha", "state", "lifecycle", "check_attempts",
+		"done", "last_message", "history",
+	} {
+		if _, ok := pending[key]; !ok {
+			t.Errorf("pending status has no %q: %v", key, pending)
+		}
+	}
+	// Optional fields are left out until they apply.
+	for _, key := range []string{"new_head_sha", "warning", "verify_deadline", "finished_at"} {
+		if _, ok := pending[key]; ok {
+			t.Errorf("pending status has %q: %v", key, pending)
+		}
+	}
+	want := map[string]any{
+		"repo":         "acme/app",
+		"pr":           float64(1),
+		"merge_method": "squash",
+		"head_sha":     "abc123",
+		"lifecycle":    "pending",
+		"done":         false,
+		"last_message": "Scheduled",
+	}
+	for k, v := range want {
+		if pending[k] != v {
+			t.Errorf("pending[%q] = %v, want %v", k, pending[k], v)
+		}
+	}
+	if deps, ok := pending["depends_on"].([]any); !ok || len(deps) != 0 {
+		t.Errorf("depends_on = %v, want []", pending["depends_on"])
+	}
+	history, ok := pending["history"].([]any)
+	if !ok || len(history) != 1 {
+		t.Fatalf("history = %v", pending["history"])
+	}
+	if entry := history[0].(map[string]any); entry["event"] != "Scheduled" || entry["to"] != "pending" {
+		t.Errorf("history[0] = %v", entry)
+	}
+
+	merged := statuses[1]
+	if merged["state"] != "merged" || merged["done"] != true || merged["finished_at"] == nil {
+		t.Errorf("merged status = %v", merged)
+	}
+
+	// A PR argument narrows the list down to its schedule.
+	_, out = runCLI(t, "status", "--json", "acme/app#2")
+	if err := json.Unmarshal([]byte(out), &statuses); err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 || statuses[0]["pr"] != float64(2) {
+		t.Errorf("status --json acme/app#2 = %v", statuses)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// ---------- PR comments ----------
+
+// The comments posted before enabling auto-merge and after a merge failed
+// are text/template templates, overridable in the config file.
+const (
+	defaultPreMergeTemplate = `Setting PR to auto-merge. Scheduled merge time: {{.When.Format "2006-01-02 15:04"}}`
+	defaultFailureTemplate  = "Auto-merge did not complete successfully. Disabling auto-merge.\n\nCurrent commit: {{.HeadSHA}}"
+)
+
+// commentsConfig is the "comments" section of the config file.
+type commentsConfig struct {
+	PreMerge commentConfig `json:"pre_merge"`
+	Failure  commentConfig `json:"failure"`
+}
+
+type commentConfig struct {
+	// Template replaces the default text; see commentData for its fields.
+	Template string `json:"template"`
+	// Disabled turns the comment off.
+	Disabled bool `json:"disabled"`
+}
+
+// commentData is what a comment template can refer to, e.g.
+// "@{{.Author}}, merging {{.PR.URL}} at {{.When.Format "15:04"}}".
+type commentData struct {
+	PR          pr        // .PR.Number, .PR.Title, .PR.URL, .PR.Repo, ...
+	Author      string    // login of the PR author
+	When        time.Time // scheduled merge time
+	MergeMethod string    // merge, squash or rebase
+	HeadSHA     string    // commit the merge is pinned to, or the branch's current one
+	User        string    // login the scheduler runs as
+	Reason      string    // why the merge failed; failure comments only
+}
+
+// commentTemplates holds the parsed templates; a nil one is turned off.
+type commentTemplates struct {
+	preMerge *template.Template
+	failure  *template.Template
+}
+
+func newCommentTemplates(cc commentsConfig) (commentTemplates, error) {
+	var t commentTemplates
+	var err error
+	if t.preMerge, err = parseCommentTemplate("pre_merge", cc.PreMerge, defaultPreMergeTemplate); err != nil {
+		return t, err
+	}
+	if t.failure, err = parseCommentTemplate("failure", cc.Failure, defaultFailureTemplate); err != nil {
+		return t, err
+	}
+	return t, nil
+}
+
+func parseCommentTemplate(name string, cc commentConfig, def string) (*template.Template, error) {
+	if cc.Disabled {
+		return nil, nil
+	}
+	text := cc.Template
+	if text == "" {
+		text = def
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err == nil {
+		// Catch unknown fields now rather than when a merge fires.
+		err = tmpl.Execute(io.Discard, commentData{})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("comments: invalid %s template: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// newCommentData fills in what the schedule itself knows, and user, the
+// login the scheduler runs as.
+func newCommentData(s scheduledMerge, user string) commentData {
+	return commentData{
+		PR:          s.PR,
+		Author:      s.PR.Author,
+		When:        s.When,
+		MergeMethod: s.MergeMethod.label(),
+		HeadSHA:     s.HeadSHA,
+		User:        user,
+		Reason:      s.FailureReason,
+	}
+}
+
+// commentTemplateCmd renders tmpl, looking up the head commit unless data
+// has it, and posts it. With a nil tmpl the comment is turned off and the
+// command reports success without posting anything.
+func commentTemplateCmd(gh GitHub, p pr, tmpl *template.Template, data commentData, isPreMerge bool) tea.Cmd {
+	return func() tea.Msg {
+		result := commentResultMsg{repo: p.Repo, prNumber: p.Number, isPreMerge: isPreMerge}
+		if tmpl == nil {
+			result.skipped = true
+			return result
+		}
+		if data.HeadSHA == "" {
+			if sha, err := gh.HeadSHA(p.Number); err == nil {
+				data.HeadSHA = sha
+			} else {
+				data.HeadSHA = "unknown"
+			}
+		}
+		var body strings.Builder
+		if err := tmpl.Execute(&body, data); err != nil {
+			result.err = fmt.Errorf("failed to render %s comment: %w", tmpl.Name(), err)
+			return result
+		}
+		result.err = gh.Comment(p.Number, body.String())
+		return result
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewCommentTemplates(t *testing.T) {
+	templates, err := newCommentTemplates(commentsConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if templates.preMerge == nil || templates.failure == nil {
+		t.Fatal("a default comment is turned off")
+	}
+
+	templates, err = newCommentTemplates(commentsConfig{Failure: commentConfig{Template: "ignored", Disabled: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if templates.preMerge == nil || templates.failure != nil {
+		t.Errorf("disabling the failure comment got %+v", templates)
+	}
+
+	for _, text := range []string{
+		"Merging {{.Reviewer}}",     // no such field
+		"Merging {{.PR.Milestone}}", // nor in the PR
+		"Merging {{.When.Format}}",  // wrong call
+		"Merging {{.PR.Number",      // syntax
+	} {
+		if _, err := newCommentTemplates(commentsConfig{PreMerge: commentConfig{Template: text}}); err == nil {
+			t.Errorf("template %q was accepted", text)
+		}
+	}
+}
+
+func TestCommentTemplateCmd(t *testing.T) {
+	const text = `@{{.Author}}: {{.User}} merges #{{.PR.Number}} ({{.PR.Title}}) at {{.When.Format "15:04"}} by {{.MergeMethod}}, commit {{.HeadSHA}}{{if .Reason}}; {{.Reason}}{{end}}`
+	templates, err := newCommentTemplates(commentsConfig{PreMerge: commentConfig{Template: text}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := scheduledMerge{PR: testPR(1), When: time.Date(2026, 10, 14, 16, 30, 0, 0, time.UTC), MergeMethod: mergeMethodSquash, HeadSHA: "sha-pinned"}
+
+	gh := newFakeGitHub("bob", testRepo, testPR(1))
+	msg := commentTemplateCmd(gh, s.PR, templates.preMerge, newCommentData(s, "alice"), true)().(commentResultMsg)
+	if msg.err != nil || msg.skipped || !msg.isPreMerge {
+		t.Fatalf("result = %+v", msg)
+	}
+	// The pinned commit and the given user, without asking GitHub.
+	want := "@bob: alice merges #1 (Change) at 16:30 by squash, commit sha-pinned"
+	if got := gh.comments(1); !slices.Equal(got, []string{want}) {
+		t.Errorf("comments = %q, want %q", got, want)
+	}
+	if want := []string{"Comment #1"}; !slices.Equal(gh.calls, want) {
+		t.Errorf("calls = %v, want %v", gh.calls, want)
+	}
+
+	// Without a pinned commit it is looked up.
+	gh = newFakeGitHub("bob", testRepo, testPR(1))
+	s.HeadSHA, s.FailureReason = "", "the PR was closed"
+	commentTemplateCmd(gh, s.PR, templates.preMerge, newCommentData(s, ""), false)()
+	want = "@bob:  merges #1 (Change) at 16:30 by squash, commit sha-1; the PR was closed"
+	if got := gh.comments(1); !slices.Equal(got, []string{want}) {
+		t.Errorf("comments = %q, want %q", got, want)
+	}
+
+	// Or "unknown" if that fails.
+	gh = newFakeGitHub("bob", testRepo, testPR(1))
+	gh.failNext("HeadSHA", errors.New("HTTP 502"))
+	commentTemplateCmd(gh, s.PR, templates.preMerge, newCommentData(s, ""), false)()
+	if got := gh.comments(1); len(got) != 1 || !strings.Contains(got[0], "commit unknown") {
+		t.Errorf("comments = %q, want the commit unknown", got)
+	}
+}
+
+func TestCommentTemplateCmdDisabled(t *testing.T) {
+	templates, err := newCommentTemplates(commentsConfig{PreMerge: commentConfig{Disabled: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gh := newFakeGitHub("bob", testRepo, testPR(1))
+	s := scheduledMerge{PR: testPR(1), HeadSHA: "sha-1"}
+	msg := commentTemplateCmd(gh, s.PR, templates.preMerge, newCommentData(s, "alice"), true)().(commentResultMsg)
+	if !msg.skipped || msg.err != nil || !msg.isPreMerge {
+		t.Errorf("result = %+v, want it skipped", msg)
+	}
+	if len(gh.calls) != 0 {
+		t.Errorf("calls = %v, want none", gh.calls)
+	}
+
+	// The scheduler merges without the comment.
+	h := newHarness(t, testPR(1))
+	h.e.comments = templates
+	h.add(scheduledMerge{PR: testPR(1), When: h.now.Add(time.Minute)})
+	h.advance(2 * time.Minute)
+	h.expectState(1, stateAwaitingMerge)
+	if got := h.gh.comments(1); len(got) != 0 {
+		t.Errorf("comments = %q, want none", got)
+	}
+	if got := h.schedule(1).LastMessage; !strings.HasPrefix(got, "Auto-merge set") {
+		t.Errorf("LastMessage = %q", got)
+	}
+}
+
+func TestPreMergeCommentData(t *testing.T) {
+	templates, err := newCommentTemplates(commentsConfig{PreMerge: commentConfig{Template: "{{.User}} merges {{.HeadSHA}}"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := newHarness(t, testPR(1))
+	h.e.comments = templates
+	h.e.user = func() string { return "alice" }
+	h.add(scheduledMerge{PR: testPR(1), When: h.now.Add(time.Minute), HeadSHA: "sha-1"})
+	h.advance(2 * time.Minute)
+	h.expectState(1, stateAwaitingMerge)
+	if got, want := h.gh.comments(1), []string{"alice merges sha-1"}; !slices.Equal(got, want) {
+		t.Errorf("comments = %q, want %q", got, want)
+	}
+	if n := h.count("CurrentUser"); n != 0 {
+		t.Errorf("CurrentUser called %d times, want 0", n)
+	}
+}
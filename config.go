@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ---------- Configuration ----------
+
+// The optional config file lives at $XDG_CONFIG_HOME/pr-scheduler/config.json
+// (default ~/.config/pr-scheduler/config.json), for example:
+//
+//	{
+//	  "backend": "gh",
+//	  "repositories": ["my-org/api", "my-org/web"],
+//	  "merge_method": "merge",
+//	  "repos": {
+//	    "my-org/api": {"merge_method": "squash"}
+//	  },
+//	  "gate": {"enabled": true, "timeout": "2h"},
+//	  "comments": {
+//	    "pre_merge": {"template": "@{{.Author}}: merging at {{.When.Format \"15:04\"}}, see https://wiki.example.com/merges"},
+//	    "failure": {"disabled": true}
+//	  },
+//	  "retry": {"max_attempts": 5, "backoff": "30s", "retry_on": ["network", "5xx", "rate_limit"]},
+//	  "update_branch": "rebase",
+//	  "verify_timeout": "2h",
+//	  "freeze": {
+//	    "business_hours": [{"days": ["mon", "tue", "wed", "thu", "fri"], "start": "09:00", "end": "17:00"}],
+//	    "calendar": "holidays.ics",
+//	    "action": "shift"
+//	  }
+//	}
+type config struct {
+	// Backend selects how GitHub is reached: "gh" (default) runs the gh CLI,
+	// "api" calls the REST/GraphQL APIs directly.
+	Backend string `json:"backend"`
+	// APIURL is the REST root for the "api" backend, for GitHub Enterprise.
+	APIURL string `json:"api_url"`
+	// Repositories lists the "owner/name" repositories whose PRs the TUI
+	// shows. Empty means the repository of the working directory.
+	Repositories []string              `json:"repositories"`
+	MergeMethod  mergeMethod           `json:"merge_method"`
+	Repos        map[string]repoConfig `json:"repos"`
+	// Freeze restricts when merges may happen (see freezePolicy).
+	Freeze freezeConfig `json:"freeze"`
+	// Gate holds due merges until their checks passed and they got approved.
+	Gate gateConfig `json:"gate"`
+	// Notifications lists where to send which events (see notifierConfig).
+	// Without it, failures raise a desktop notification.
+	Notifications []notifierConfig `json:"notifications"`
+	// Comments customises the comments posted on PRs (see commentData).
+	Comments commentsConfig `json:"comments"`
+	// Retry says which failed merge steps are retried (see retryPolicy).
+	Retry retryConfig `json:"retry"`
+	// UpdateBranch is how new schedules bring a PR that is behind its base up
+	// to date: "merge", "rebase", or "" / "off" to leave it alone.
+	UpdateBranch string `json:"update_branch"`
+	// VerifyTimeout is how long to keep checking that an auto-merge went
+	// through before giving up, e.g. "2h". The TUI can change it per schedule.
+	VerifyTimeout string `json:"verify_timeout"`
+}
+
+// repoConfig overrides the global settings for one "owner/name" repository.
+type repoConfig struct {
+	MergeMethod  mergeMethod `json:"merge_method"`
+	Gate         *bool       `json:"gate"`
+	UpdateBranch string      `json:"update_branch"`
+}
+
+// Defaults of gateConfig.Timeout and config.VerifyTimeout.
+const (
+	defaultChecksTimeout = time.Hour
+	defaultVerifyTimeout = time.Hour
+)
+
+type gateConfig struct {
+	// Enabled turns the gate on for new schedules; off by default.
+	Enabled bool `json:"enabled"`
+	// Timeout is how long to wait for pending checks or a review, e.g. "2h".
+	Timeout string `json:"timeout"`
+}
+
+// timeout returns the gate timeout; loadConfig has validated it.
+func (g gateConfig) timeout() time.Duration {
+	if d, err := time.ParseDuration(g.Timeout); err == nil && d > 0 {
+		return d
+	}
+	return defaultChecksTimeout
+}
+
+// verifyTimeout returns how long new schedules keep verifying their merge.
+func (c config) verifyTimeout() time.Duration {
+	if d, err := time.ParseDuration(c.VerifyTimeout); err == nil && d > 0 {
+		return d
+	}
+	return defaultVerifyTimeout
+}
+
+func configFilePath() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to locate home directory: %w", err)
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "pr-scheduler", "config.json"), nil
+}
+
+// loadConfig reads the config file. A missing file yields the defaults.
+func loadConfig() (config, error) {
+	var cfg config
+	path, err := configFilePath()
+	if err != nil {
+		return cfg, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read config: %w", err)
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+
+	switch cfg.Backend {
+	case "", "gh", "api":
+	default:
+		return cfg, fmt.Errorf("config %s: unknown backend %q (want gh or api)", path, cfg.Backend)
+	}
+	for _, repo := range cfg.Repositories {
+		if err := validateRepo(repo); err != nil {
+			return cfg, fmt.Errorf("config %s: %w", path, err)
+		}
+	}
+	if _, err := parseMergeMethod(string(cfg.MergeMethod)); err != nil {
+		return cfg, fmt.Errorf("config %s: %w", path, err)
+	}
+	if cfg.Gate.Timeout != "" {
+		if d, err := time.ParseDuration(cfg.Gate.Timeout); err != nil || d <= 0 {
+			return cfg, fmt.Errorf("config %s: invalid gate timeout %q", path, cfg.Gate.Timeout)
+		}
+	}
+	if _, err := newNotifiers(cfg.Notifications); err != nil {
+		return cfg, fmt.Errorf("config %s: %w", path, err)
+	}
+	if _, err := newCommentTemplates(cfg.Comments); err != nil {
+		return cfg, fmt.Errorf("config %s: %w", path, err)
+	}
+	if _, err := newRetryPolicy(cfg.Retry); err != nil {
+		return cfg, fmt.Errorf("config %s: %w", path, err)
+	}
+	if _, err := parseUpdateBranch(cfg.UpdateBranch); err != nil {
+		return cfg, fmt.Errorf("config %s: %w", path, err)
+	}
+	if cfg.VerifyTimeout != "" {
+		if d, err := time.ParseDuration(cfg.VerifyTimeout); err != nil || d <= 0 {
+			return cfg, fmt.Errorf("config %s: invalid verify_timeout %q", path, cfg.VerifyTimeout)
+		}
+	}
+	for name, rc := range cfg.Repos {
+		if _, err := parseMergeMethod(string(rc.MergeMethod)); err != nil {
+			return cfg, fmt.Errorf("config %s: repo %s: %w", path, name, err)
+		}
+		if _, err := parseUpdateBranch(rc.UpdateBranch); err != nil {
+			return cfg, fmt.Errorf("config %s: repo %s: %w", path, name, err)
+		}
+	}
+	return cfg, nil
+}
+
+// newGitHub returns the configured GitHub backend for an "owner/name"
+// repository ("" for the repository of the working directory). Calls about
+// a PR are recorded in the audit log.
+func (c config) newGitHub(repo string) GitHub {
+	if c.Backend != "api" {
+		return auditedGitHub{newGHCLI(repo), repo}
+	}
+	client, err := newAPIClient(c.APIURL, repo)
+	if err != nil {
+		return auditedGitHub{unavailableGitHub{err}, repo}
+	}
+	return auditedGitHub{client, repo}
+}
+
+// currentUser asks the configured backend for the login of the authenticated
+// user. Unlike newGitHub("").CurrentUser, it works outside a checkout.
+func (c config) currentUser() (string, error) {
+	if c.Backend != "api" {
+		return newGHCLI("").CurrentUser()
+	}
+	client, err := newUserAPIClient(c.APIURL)
+	if err != nil {
+		return "", err
+	}
+	return client.CurrentUser()
+}
+
+// validateRepo checks an "owner/name" repository reference.
+func validateRepo(repo string) error {
+	owner, name, ok := strings.Cut(repo, "/")
+	if !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+		return fmt.Errorf("invalid repository %q, want owner/name", repo)
+	}
+	return nil
+}
+
+// gateFor reports whether new schedules of a repository are gated.
+func (c config) gateFor(repo string) bool {
+	if rc, ok := c.Repos[repo]; ok && rc.Gate != nil {
+		return *rc.Gate
+	}
+	return c.Gate.Enabled
+}
+
+// updateBranchFor returns how new schedules of a repository update a PR
+// branch that is behind: "merge", "rebase" or "" for not at all.
+func (c config) updateBranchFor(repo string) string {
+	if rc, ok := c.Repos[repo]; ok && rc.UpdateBranch != "" {
+		mode, _ := parseUpdateBranch(rc.UpdateBranch)
+		return mode
+	}
+	mode, _ := parseUpdateBranch(c.UpdateBranch)
+	return mode
+}
+
+// freezePolicy loads the configured merge freeze, nil if there is none.
+func (c config) freezePolicy() (*freezePolicy, error) {
+	path, err := configFilePath()
+	if err != nil {
+		return nil, err
+	}
+	return newFreezePolicy(c.Freeze, filepath.Dir(path))
+}
+
+// mergeMethodFor returns the merge method to preselect for a repository.
+func (c config) mergeMethodFor(repo string) mergeMethod {
+	if rc, ok := c.Repos[repo]; ok && rc.MergeMethod != "" {
+		return rc.MergeMethod
+	}
+	if c.MergeMethod != "" {
+		return c.MergeMethod
+	}
+	return mergeMethodMerge
+}
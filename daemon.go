@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// ---------- Daemon ----------
+
+// The daemon owns the scheduling pipeline. It runs without a terminal, reads
+// and writes the shared state file, and keeps merging while no TUI is open.
+// The TUI (and any other client) only adds schedules to the state file and
+// displays what the daemon reports back.
+
+const (
+	daemonLockFileName = "daemon.lock"
+	daemonLogFileName  = "daemon.log"
+
+	// How long a shutdown waits for gh calls that are already running.
+	daemonShutdownTimeout = 30 * time.Second
+)
+
+// daemonRunning reports whether a daemon currently holds the daemon lock.
+func daemonRunning() bool {
+	release, err := lockFile(daemonLockFileName, true)
+	if err != nil {
+		return errors.Is(err, syscall.EWOULDBLOCK)
+	}
+	release()
+	return false
+}
+
+// startDaemon launches `pr-scheduler daemon` in its own session so it outlives
+// the terminal it was started from. Its output goes to daemon.log in the
+// state directory.
+func startDaemon() (int, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, fmt.Errorf("failed to locate executable: %w", err)
+	}
+	logPath, err := statePath(daemonLogFileName)
+	if err != nil {
+		return 0, err
+	}
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open daemon log: %w", err)
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(exe, "daemon")
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("failed to start daemon: %w", err)
+	}
+	pid := cmd.Process.Pid
+	_ = cmd.Process.Release()
+	return pid, nil
+}
+
+// runDaemonCommand is the entry point of `pr-scheduler daemon`. With
+// --dry-run every schedule is a dry run.
+func runDaemonCommand(args []string) int {
+	fs := newFlagSet("daemon")
+	dryRun := fs.Bool("dry-run", false, "only log the calls that would change PRs")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return usageError(err)
+	}
+	if len(positional) != 0 {
+		return usageError(errors.New("daemon takes no arguments"))
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitError
+	}
+	sched, err := newScheduler(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitError
+	}
+	logger := log.New(os.Stderr, "pr-scheduler: ", log.LstdFlags)
+	sched.dryRun = *dryRun
+	sched.logf = logger.Printf
+	sched.user = audit.login // resolved by runDaemon
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+	if err := runDaemon(ctx, sched, cfg.currentUser, logger); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// resolveDaemonUser looks up the login the daemon acts as, for the audit log.
+// It runs before the daemon touches the state file, so no lookup ever holds
+// its lock up, and keeps retrying in the background while it fails.
+func resolveDaemonUser(ctx context.Context, lookupUser func() (string, error), logger *log.Logger) {
+	login, err := lookupUser()
+	if err == nil {
+		audit.setUser(login)
+		return
+	}
+	logger.Printf("failed to look up the GitHub user, retrying: %v", err)
+	go func() {
+		delay := defaultRetryBackoff
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			login, err := lookupUser()
+			if err == nil {
+				audit.setUser(login)
+				logger.Printf("running as GitHub user %s", login)
+				return
+			}
+			delay = min(2*delay, maxRetryBackoff)
+		}
+	}()
+}
+
+// runDaemon drives the schedules until ctx is cancelled. On shutdown it stops
+// starting new steps but lets the gh calls already in flight (and their
+// follow-ups) finish, so every schedule is left at a well-defined step.
+func runDaemon(ctx context.Context, sched scheduler, lookupUser func() (string, error), logger *log.Logger) error {
+	release, err := lockFile(daemonLockFileName, true)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return errors.New("another pr-scheduler daemon is already running")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to acquire daemon lock: %w", err)
+	}
+	defer release()
+	resolveDaemonUser(ctx, lookupUser, logger)
+
+	// Commands run in their own goroutines and report back on results. Only
+	// this goroutine touches pending, so it needs no locking.
+	results := make(chan tea.Msg)
+	pending := 0
+	launch := func(cmds []tea.Cmd) {
+		for _, cmd := range cmds {
+			if cmd == nil {
+				continue
+			}
+			pending++
+			go func() { results <- cmd() }()
+		}
+	}
+
+	// update runs fn against the state file and logs what was added to the
+	// history of every schedule, and messages that changed. Transitions go to
+	// the audit log.
+	update := func(fn func(scheduled []scheduledMerge, now time.Time) []tea.Cmd) {
+		var cmds []tea.Cmd
+		err := updateSchedules(func(scheduled []scheduledMerge) ([]scheduledMerge, error) {
+			before := make([]string, len(scheduled))
+			history := make([]int, len(scheduled))
+			for i, s := range scheduled {
+				before[i] = s.LastMessage
+				history[i] = len(s.History)
+			}
+			cmds = fn(scheduled, time.Now())
+			for i, s := range scheduled {
+				if i >= len(before) {
+					continue
+				}
+				logged := before[i]
+				for _, h := range s.History[history[i]:] {
+					logger.Printf("%s: %s", s.PR.ref(), h.Event)
+					logged = h.Event
+					if h.To != "" {
+						audit.recordSchedule("state", s, fmt.Sprintf("%s -> %s: %s", h.From, h.To, h.Event))
+					}
+				}
+				if logged != s.LastMessage {
+					logger.Printf("%s: %s", s.PR.ref(), s.LastMessage)
+				}
+			}
+			return scheduled, nil
+		})
+		if err != nil {
+			logger.Printf("error: %v", err)
+			return
+		}
+		launch(cmds)
+	}
+	apply := func(msg tea.Msg) {
+		pending--
+		update(func(scheduled []scheduledMerge, now time.Time) []tea.Cmd {
+			return sched.applyResult(scheduled, msg, now)
+		})
+	}
+
+	if sched.dryRun {
+		logger.Printf("daemon started in dry-run mode (pid %d)", os.Getpid())
+	} else {
+		logger.Printf("daemon started (pid %d)", os.Getpid())
+	}
+	update(func(scheduled []scheduledMerge, now time.Time) []tea.Cmd {
+		var cmds []tea.Cmd
+		for i := range scheduled {
+			cmds = append(cmds, sched.resumeSchedule(&scheduled[i], now))
+		}
+		return cmds
+	})
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			update(sched.stepSchedules)
+
+		case msg := <-results:
+			apply(msg)
+
+		case <-ctx.Done():
+			logger.Printf("shutting down, waiting for %d in-flight command(s)", pending)
+			timeout := time.After(daemonShutdownTimeout)
+			for pending > 0 {
+				select {
+				case msg := <-results:
+					apply(msg)
+				case <-timeout:
+					logger.Printf("daemon stopped with commands still running; they will be resumed on next start")
+					return nil
+				}
+			}
+			logger.Printf("daemon stopped")
+			return nil
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// ---------- PR details ----------
+
+// prDetailsMsg carries what the detail pane shows about p.
+type prDetailsMsg struct {
+	p       pr
+	details prDetails
+	err     error
+}
+
+func fetchDetailsCmd(gh GitHub, p pr) tea.Cmd {
+	return func() tea.Msg {
+		details, err := gh.PRDetails(p.Number)
+		return prDetailsMsg{p: p, details: details, err: err}
+	}
+}
+
+// latestSchedule returns the most recent schedule of a PR, finished or not.
+func latestSchedule(scheduled []scheduledMerge, p pr) (scheduledMerge, bool) {
+	for i := len(scheduled) - 1; i >= 0; i-- {
+		if s := scheduled[i]; s.PR.Repo == p.Repo && s.PR.Number == p.Number {
+			return s, true
+		}
+	}
+	return scheduledMerge{}, false
+}
+
+// render draws the detail pane of the PR and its schedule, if any.
+func (d prDetails) render(s *scheduledMerge, now time.Time) string {
+	headerStyle := lipgloss.NewStyle().Bold(true)
+	faintStyle := lipgloss.NewStyle().Faint(true)
+	okStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("10"))
+	errStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+	pendingStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("11"))
+	dryRunStyle := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("0")).Background(lipgloss.Color("11"))
+
+	var b strings.Builder
+	p := d.PR
+	b.WriteString(headerStyle.Render(fmt.Sprintf("#%d %s", p.Number, p.Title)))
+	b.WriteString("\n")
+	line := fmt.Sprintf("%s by @%s | %s", p.Repo, p.Author, p.State)
+	if p.Draft {
+		line += " | draft"
+	}
+	b.WriteString(line + "\n")
+	b.WriteString(fmt.Sprintf("%s → %s at %s\n", p.HeadRef, p.BaseRef, shortSHA(p.HeadSHA)))
+	b.WriteString(fmt.Sprintf("+%d -%d in %d files\n", d.Additions, d.Deletions, d.ChangedFiles))
+	if p.URL != "" {
+		b.WriteString(faintStyle.Render(p.URL))
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+
+	mergeable := fmt.Sprintf("Mergeable: %s (%s)", strings.ToLower(d.Mergeable), strings.ToLower(p.MergeState))
+	if d.Mergeable == "CONFLICTING" {
+		mergeable = errStyle.Render(mergeable)
+	}
+	b.WriteString(mergeable + "\n")
+
+	decision := "not required"
+	if p.ReviewDecision != "" {
+		decision = strings.ToLower(strings.ReplaceAll(p.ReviewDecision, "_", " "))
+	}
+	b.WriteString("Review: " + decision + "\n")
+	for _, r := range d.Reviews {
+		state := strings.ToLower(strings.ReplaceAll(r.State, "_", " "))
+		switch r.State {
+		case "APPROVED":
+			b.WriteString(okStyle.Render("  ✓ @"+r.Author+" "+state) + "\n")
+		case "CHANGES_REQUESTED":
+			b.WriteString(errStyle.Render("  ✗ @"+r.Author+" "+state) + "\n")
+		default:
+			b.WriteString("  • @" + r.Author + " " + state + "\n")
+		}
+	}
+	if len(p.ReviewRequests) > 0 {
+		b.WriteString("  requested: " + strings.Join(p.ReviewRequests, ", ") + "\n")
+	}
+
+	if len(p.Assignees) > 0 {
+		b.WriteString("Assignees: @" + strings.Join(p.Assignees, ", @") + "\n")
+	}
+	if len(p.Labels) > 0 {
+		b.WriteString("Labels: " + strings.Join(p.Labels, ", ") + "\n")
+	}
+
+	counts := map[string]int{}
+	for _, c := range d.Checks {
+		counts[checkOutcome(c.Result)]++
+	}
+	if len(d.Checks) == 0 {
+		b.WriteString("Checks: none\n")
+	} else {
+		b.WriteString(fmt.Sprintf("Checks: %d passed, %d failing, %d pending\n", counts["SUCCESS"], counts["FAILURE"], counts["PENDING"]))
+	}
+	for _, c := range d.Checks {
+		result := strings.ToLower(c.Result)
+		switch checkOutcome(c.Result) {
+		case "SUCCESS":
+			text := "  ✓ " + c.Name
+			if c.Result != "SUCCESS" {
+				text += " (" + result + ")"
+			}
+			b.WriteString(okStyle.Render(text) + "\n")
+		case "FAILURE":
+			b.WriteString(errStyle.Render("  ✗ "+c.Name+" ("+result+")") + "\n")
+		default:
+			b.WriteString(pendingStyle.Render("  • "+c.Name+" (pending)") + "\n")
+		}
+	}
+	b.WriteString("\n")
+
+	if s == nil {
+		b.WriteString("Schedule: none (enter to schedule)\n")
+		return b.String()
+	}
+	line = fmt.Sprintf("Schedule: %s (%s) [%s]", s.When.Format("2006-01-02 15:04"), s.MergeMethod.label(), s.stateLabel())
+	if s.DryRun {
+		line += " " + dryRunStyle.Render(" DRY RUN ")
+	}
+	if progress := s.verifyProgress(now); progress != "" {
+		line += " (" + progress + ")"
+	}
+	b.WriteString(line + "\n")
+	if len(s.DependsOn) > 0 {
+		b.WriteString("  after " + strings.Join(s.dependencyRefs(), ", ") + "\n")
+	}
+	if s.DryRun {
+		b.WriteString("  comments, auto-merge and branch changes are only logged\n")
+	}
+	if s.LastMessage != "" {
+		b.WriteString("  " + s.LastMessage + "\n")
+	}
+	if s.Warning != "" && !s.done() {
+		b.WriteString(errStyle.Render("  "+s.Warning) + "\n")
+	}
+	if s.NewHeadSHA != "" && !s.done() {
+		b.WriteString(errStyle.Render(fmt.Sprintf("  %s pushed since scheduling, re-confirm in the scheduled merges panel (a)", shortSHA(s.NewHeadSHA))) + "\n")
+	}
+	return b.String()
+}
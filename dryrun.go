@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ---------- Dry run ----------
+
+// dryRunGitHub reads from GitHub as usual but only logs the calls that would
+// change a PR (comments, auto-merge, base and branch updates), reporting them
+// as successful so a schedule runs through its whole lifecycle.
+type dryRunGitHub struct {
+	GitHub
+	repo string
+	// logf reports what would have been done; nil discards it.
+	logf func(format string, args ...any)
+}
+
+// skip logs a call that was not made.
+func (g dryRunGitHub) skip(method string, number int, format string, args ...any) error {
+	what := "would " + fmt.Sprintf(format, args...)
+	if g.logf != nil {
+		g.logf("dry run: %s on %s", what, pr{Repo: g.repo, Number: number}.ref())
+	}
+	audit.record(auditEntry{Repo: g.repo, PR: number, Action: "gh." + method, Detail: "dry run: " + what})
+	return nil
+}
+
+func (g dryRunGitHub) Comment(number int, body string) error {
+	return g.skip("Comment", number, "comment %q", strings.ReplaceAll(body, "\n", " "))
+}
+
+func (g dryRunGitHub) EnableAutoMerge(number int, method mergeMethod, headSHA string) error {
+	if headSHA != "" {
+		return g.skip("EnableAutoMerge", number, "enable auto-merge (%s) of %s", method.label(), headSHA)
+	}
+	return g.skip("EnableAutoMerge", number, "enable auto-merge (%s)", method.label())
+}
+
+func (g dryRunGitHub) DisableAutoMerge(number int) error {
+	return g.skip("DisableAutoMerge", number, "disable auto-merge")
+}
+
+func (g dryRunGitHub) SetBase(number int, base string) error {
+	return g.skip("SetBase", number, "change the base branch to %s", base)
+}
+
+func (g dryRunGitHub) UpdateBranch(number int, rebase bool) error {
+	how := "merge"
+	if rebase {
+		how = "rebase"
+	}
+	return g.skip("UpdateBranch", number, "update the branch (%s)", how)
+}
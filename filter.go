@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ---------- PR filters ----------
+
+// prFilter selects the PRs listed. The filters combine: a PR is listed when
+// it matches every one that is set. The zero value lists all PRs.
+type prFilter struct {
+	onlyMine  bool
+	labels    []string // has all of these labels
+	base      string   // merges into this branch
+	draft     string   // "draft" or "ready"
+	review    string   // a key of reviewFilters
+	requested bool     // a review is requested from the current user
+	assignee  string   // assigned to this login; "me" is the current user
+}
+
+// reviewFilters maps the review: filter values to review decisions.
+var reviewFilters = map[string]string{
+	"approved": "APPROVED",
+	"changes":  "CHANGES_REQUESTED",
+	"required": "REVIEW_REQUIRED",
+	"none":     "",
+}
+
+// parsePRFilter reads filters written the way String prints them, e.g.
+// `mine label:bug base:main ready review:approved requested assignee:me`.
+// Values with spaces are quoted: `label:"good first issue"`.
+func parsePRFilter(s string) (prFilter, error) {
+	var f prFilter
+	for _, tok := range splitFilter(s) {
+		key, value, _ := strings.Cut(tok, ":")
+		switch {
+		case tok == "mine":
+			f.onlyMine = true
+		case tok == "draft", tok == "ready":
+			f.draft = tok
+		case tok == "requested":
+			f.requested = true
+		case key == "label" && value != "":
+			f.labels = append(f.labels, value)
+		case key == "base" && value != "":
+			f.base = value
+		case key == "assignee" && value != "":
+			f.assignee = strings.TrimPrefix(value, "@")
+		case key == "review":
+			if _, ok := reviewFilters[value]; !ok {
+				return prFilter{}, fmt.Errorf("invalid review filter %q (want approved, changes, required or none)", value)
+			}
+			f.review = value
+		default:
+			return prFilter{}, fmt.Errorf("unknown filter %q (want mine, label:, base:, draft, ready, review:, requested or assignee:)", tok)
+		}
+	}
+	return f, nil
+}
+
+// splitFilter splits s at spaces outside double quotes, dropping the quotes.
+func splitFilter(s string) []string {
+	var (
+		toks   []string
+		tok    strings.Builder
+		quoted bool
+	)
+	for _, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ' ' && !quoted:
+			if tok.Len() > 0 {
+				toks = append(toks, tok.String())
+				tok.Reset()
+			}
+		default:
+			tok.WriteRune(r)
+		}
+	}
+	if tok.Len() > 0 {
+		toks = append(toks, tok.String())
+	}
+	return toks
+}
+
+// String lists the active filters as parsePRFilter reads them, or "" when
+// there are none.
+func (f prFilter) String() string {
+	var parts []string
+	if f.onlyMine {
+		parts = append(parts, "mine")
+	}
+	for _, l := range f.labels {
+		if strings.Contains(l, " ") {
+			l = `"` + l + `"`
+		}
+		parts = append(parts, "label:"+l)
+	}
+	if f.base != "" {
+		parts = append(parts, "base:"+f.base)
+	}
+	if f.draft != "" {
+		parts = append(parts, f.draft)
+	}
+	if f.review != "" {
+		parts = append(parts, "review:"+f.review)
+	}
+	if f.requested {
+		parts = append(parts, "requested")
+	}
+	if f.assignee != "" {
+		parts = append(parts, "assignee:"+f.assignee)
+	}
+	return strings.Join(parts, " ")
+}
+
+// matches reports whether p passes the filters. me is the current user's
+// login; the filters on it are ignored until it is known.
+func (f prFilter) matches(p pr, me string) bool {
+	if f.onlyMine && me != "" && p.Author != me {
+		return false
+	}
+	for _, l := range f.labels {
+		if !slices.ContainsFunc(p.Labels, func(pl string) bool { return strings.EqualFold(pl, l) }) {
+			return false
+		}
+	}
+	if f.base != "" && p.BaseRef != f.base {
+		return false
+	}
+	if (f.draft == "draft" && !p.Draft) || (f.draft == "ready" && p.Draft) {
+		return false
+	}
+	if f.review != "" && p.ReviewDecision != reviewFilters[f.review] {
+		return false
+	}
+	if f.requested && me != "" && !slices.Contains(p.ReviewRequests, me) {
+		return false
+	}
+	assignee := f.assignee
+	if assignee == "me" {
+		assignee = me
+	}
+	if assignee != "" && !slices.Contains(p.Assignees, assignee) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestSplitFilter(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"   ", nil},
+		{"mine", []string{"mine"}},
+		{"  mine   label:bug ", []string{"mine", "label:bug"}},
+		{`label:"good first issue" ready`, []string{"label:good first issue", "ready"}},
+		{`"label:needs review"`, []string{"label:needs review"}},
+		{`label:a"b c"d`, []string{"label:ab cd"}},
+		{`label:""`, []string{"label:"}},
+		// An unclosed quote runs to the end.
+		{`label:"wip mine`, []string{"label:wip mine"}},
+	}
+	for _, tt := range tests {
+		if got := splitFilter(tt.in); !slices.Equal(got, tt.want) {
+			t.Errorf("splitFilter(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParsePRFilter(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    prFilter
+		wantErr bool
+	}{
+		{in: "", want: prFilter{}},
+		{in: "mine", want: prFilter{onlyMine: true}},
+		{in: "label:bug label:ui", want: prFilter{labels: []string{"bug", "ui"}}},
+		{in: `label:"good first issue"`, want: prFilter{labels: []string{"good first issue"}}},
+		{in: "base:release/1.2", want: prFilter{base: "release/1.2"}},
+		{in: "draft", want: prFilter{draft: "draft"}},
+		{in: "draft ready", want: prFilter{draft: "ready"}}, // the last one wins
+		{in: "review:none requested", want: prFilter{review: "none", requested: true}},
+		{in: "assignee:@alice", want: prFilter{assignee: "alice"}},
+		{in: "assignee:me", want: prFilter{assignee: "me"}},
+		{
+			in:   `mine label:bug base:main ready review:approved requested assignee:me`,
+			want: prFilter{onlyMine: true, labels: []string{"bug"}, base: "main", draft: "ready", review: "approved", requested: true, assignee: "me"},
+		},
+		{in: "author:bob", wantErr: true},
+		{in: "Mine", wantErr: true},
+		{in: "label:", wantErr: true},
+		{in: "base:", wantErr: true},
+		{in: "review:", wantErr: true},
+		{in: "review:lgtm", wantErr: true},
+		{in: "mine bogus", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parsePRFilter(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parsePRFilter(%q) = %+v, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parsePRFilter(%q) = %+v, %v, want %+v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestPRFilterString(t *testing.T) {
+	tests := []struct {
+		f    prFilter
+		want string
+	}{
+		{prFilter{}, ""},
+		{prFilter{onlyMine: true}, "mine"},
+		{prFilter{labels: []string{"bug", "good first issue"}}, `label:bug label:"good first issue"`},
+		{
+			prFilter{onlyMine: true, labels: []string{"bug"}, base: "main", draft: "draft", review: "changes", requested: true, assignee: "alice"},
+			"mine label:bug base:main draft review:changes requested assignee:alice",
+		},
+	}
+	for _, tt := range tests {
+		got := tt.f.String()
+		if got != tt.want {
+			t.Errorf("%+v.String() = %q, want %q", tt.f, got, tt.want)
+		}
+		// What String prints reads back as the same filters.
+		back, err := parsePRFilter(got)
+		if err != nil || !reflect.DeepEqual(back, tt.f) {
+			t.Errorf("parsePRFilter(%q) = %+v, %v, want %+v", got, back, err, tt.f)
+		}
+	}
+}
+
+func TestPRFilterMatches(t *testing.T) {
+	p := testPR(1)
+	p.Labels = []string{"Bug", "good first issue"}
+	p.ReviewDecision = "APPROVED"
+	p.ReviewRequests = []string{"alice"}
+	p.Assignees = []string{"carol"}
+	draft := testPR(2)
+	draft.Draft = true
+
+	tests := []struct {
+		name   string
+		filter string
+		pr     pr
+		me     string
+		want   bool
+	}{
+		{"no filters", "", p, "alice", true},
+		{"mine", "mine", p, "bob", true},
+		{"not mine", "mine", p, "alice", false},
+		{"mine before the user is known", "mine", p, "", true},
+		{"label in another case", "label:bug", p, "", true},
+		{"quoted label", `label:"good first issue"`, p, "", true},
+		{"missing label", "label:bug label:ui", p, "", false},
+		{"base", "base:main", p, "", true},
+		{"other base", "base:develop", p, "", false},
+		{"ready", "ready", p, "", true},
+		{"ready draft", "ready", draft, "", false},
+		{"draft", "draft", draft, "", true},
+		{"approved", "review:approved", p, "", true},
+		{"changes requested", "review:changes", p, "", false},
+		{"no review decision", "review:none", draft, "", true},
+		{"review requested", "requested", p, "alice", true},
+		{"review requested from someone else", "requested", p, "dave", false},
+		{"assignee", "assignee:carol", p, "", true},
+		{"assigned to me", "assignee:me", p, "carol", true},
+		{"not assigned to me", "assignee:me", p, "alice", false},
+		{"every term matches", "mine label:bug base:main ready review:approved assignee:carol", p, "bob", true},
+		{"one term fails", "mine label:bug base:main draft review:approved assignee:carol", p, "bob", false},
+	}
+	for _, tt := range tests {
+		f, err := parsePRFilter(tt.filter)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := f.matches(tt.pr, tt.me); got != tt.want {
+			t.Errorf("%s: %q matches #%d as %s = %v, want %v", tt.name, tt.filter, tt.pr.Number, tt.me, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ---------- Merge freeze ----------
+
+// A freezePolicy says when merges may happen: inside the weekly business
+// hours, if any are configured, and outside every blackout period of the
+// freeze calendar. It is checked when a schedule is created and again when
+// it fires.
+type freezePolicy struct {
+	windows   []weeklyWindow
+	blackouts []blackout // sorted by start
+	refuse    bool       // refuse merges inside a freeze instead of shifting them
+}
+
+// weeklyWindow is a business-hours window repeated every week, in local time.
+type weeklyWindow struct {
+	days       [7]bool // indexed by time.Weekday
+	start, end int     // minutes since midnight, end exclusive
+}
+
+// blackout is a period in which nothing may be merged, e.g. a holiday.
+type blackout struct {
+	start, end time.Time
+	summary    string
+}
+
+// freezeConfig is the "freeze" section of the config file.
+type freezeConfig struct {
+	// BusinessHours are the weekly windows merges may happen in. Empty means
+	// any time.
+	BusinessHours []businessHours `json:"business_hours"`
+	// Calendar is an .ics file whose events are blackout periods. Relative
+	// paths are resolved against the config directory.
+	Calendar string `json:"calendar"`
+	// Action is "shift" (default) to move a merge to the next allowed time,
+	// or "refuse" to reject it.
+	Action string `json:"action"`
+}
+
+type businessHours struct {
+	Days  []string `json:"days"`  // e.g. ["mon", "tue"]
+	Start string   `json:"start"` // "09:00"
+	End   string   `json:"end"`   // "18:00", exclusive
+}
+
+// newFreezePolicy builds the policy from the config, loading the calendar. It
+// returns nil when no freeze is configured.
+func newFreezePolicy(fc freezeConfig, configDir string) (*freezePolicy, error) {
+	if len(fc.BusinessHours) == 0 && fc.Calendar == "" {
+		return nil, nil
+	}
+	p := &freezePolicy{}
+	switch fc.Action {
+	case "", "shift":
+	case "refuse":
+		p.refuse = true
+	default:
+		return nil, fmt.Errorf("freeze: unknown action %q (want shift or refuse)", fc.Action)
+	}
+
+	for _, bh := range fc.BusinessHours {
+		w, err := parseBusinessHours(bh)
+		if err != nil {
+			return nil, fmt.Errorf("freeze: %w", err)
+		}
+		p.windows = append(p.windows, w)
+	}
+
+	if fc.Calendar != "" {
+		path := fc.Calendar
+		if rest, ok := strings.CutPrefix(path, "~/"); ok {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, fmt.Errorf("failed to locate home directory: %w", err)
+			}
+			path = filepath.Join(home, rest)
+		} else if !filepath.IsAbs(path) {
+			path = filepath.Join(configDir, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read freeze calendar: %w", err)
+		}
+		if p.blackouts, err = parseICS(data); err != nil {
+			return nil, fmt.Errorf("freeze calendar %s: %w", path, err)
+		}
+	}
+	return p, nil
+}
+
+func parseBusinessHours(bh businessHours) (weeklyWindow, error) {
+	var w weeklyWindow
+	if len(bh.Days) == 0 {
+		return w, fmt.Errorf("business hours %s-%s: no days given", bh.Start, bh.End)
+	}
+	for _, d := range bh.Days {
+		wd, ok := weekdays[strings.ToLower(d)]
+		if !ok {
+			return w, fmt.Errorf("business hours: unknown day %q", d)
+		}
+		w.days[wd] = true
+	}
+	var err error
+	if w.start, err = parseClock(bh.Start); err != nil {
+		return w, fmt.Errorf("business hours: %w", err)
+	}
+	if w.end, err = parseClock(bh.End); err != nil {
+		return w, fmt.Errorf("business hours: %w", err)
+	}
+	if w.end <= w.start {
+		return w, fmt.Errorf("business hours: %s is not after %s", bh.End, bh.Start)
+	}
+	return w, nil
+}
+
+// parseClock parses "HH:MM" into minutes since midnight; "24:00" is allowed
+// as the end of a day.
+func parseClock(s string) (int, error) {
+	var h, m int
+	if _, err := fmt.Sscanf(s, "%d:%d", &h, &m); err != nil || h < 0 || m < 0 || m > 59 || h*60+m > 24*60 {
+		return 0, fmt.Errorf("invalid time %q, want HH:MM", s)
+	}
+	return h*60 + m, nil
+}
+
+// blocked reports why t is not an allowed merge time, or "" if it is.
+func (p *freezePolicy) blocked(t time.Time) string {
+	if b := p.blackoutAt(t); b != nil {
+		if b.summary != "" {
+			return "merge freeze: " + b.summary
+		}
+		return "merge freeze"
+	}
+	if len(p.windows) > 0 && !p.inBusinessHours(t) {
+		return "outside business hours"
+	}
+	return ""
+}
+
+func (p *freezePolicy) blackoutAt(t time.Time) *blackout {
+	for i := range p.blackouts {
+		b := &p.blackouts[i]
+		if !t.Before(b.start) && t.Before(b.end) {
+			return b
+		}
+	}
+	return nil
+}
+
+func (p *freezePolicy) inBusinessHours(t time.Time) bool {
+	t = t.In(time.Local)
+	minute := t.Hour()*60 + t.Minute()
+	for _, w := range p.windows {
+		if w.days[t.Weekday()] && minute >= w.start && minute < w.end {
+			return true
+		}
+	}
+	return false
+}
+
+// nextWindowStart returns the start of the first business-hours window
+// after t.
+func (p *freezePolicy) nextWindowStart(t time.Time) (time.Time, bool) {
+	t = t.In(time.Local)
+	var next time.Time
+	for d := 0; d <= 7; d++ {
+		day := t.AddDate(0, 0, d)
+		for _, w := range p.windows {
+			if !w.days[day.Weekday()] {
+				continue
+			}
+			start := time.Date(day.Year(), day.Month(), day.Day(), 0, w.start, 0, 0, time.Local)
+			if start.After(t) && (next.IsZero() || start.Before(next)) {
+				next = start
+			}
+		}
+		if !next.IsZero() {
+			return next, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// nextAllowed returns the first allowed merge time at or after t.
+func (p *freezePolicy) nextAllowed(t time.Time) (time.Time, bool) {
+	// Each step jumps past one blackout or to the next window, so a bounded
+	// loop is plenty unless the calendar freezes everything.
+	for i := 0; i < 1000; i++ {
+		if b := p.blackoutAt(t); b != nil {
+			t = b.end
+			continue
+		}
+		if len(p.windows) > 0 && !p.inBusinessHours(t) {
+			next, ok := p.nextWindowStart(t)
+			if !ok {
+				return time.Time{}, false
+			}
+			t = next
+			continue
+		}
+		return t.In(time.Local), true
+	}
+	return time.Time{}, false
+}
+
+// check applies the policy to a merge time. It returns the time to merge at
+// and, if that differs from when, a message saying why. With the "refuse"
+// action a blocked time is an error instead.
+func (p *freezePolicy) check(when time.Time) (time.Time, string, error) {
+	if p == nil {
+		return when, "", nil
+	}
+	reason := p.blocked(when)
+	if reason == "" {
+		return when, "", nil
+	}
+	if p.refuse {
+		return when, "", fmt.Errorf("%s at %s", reason, when.Format("2006-01-02 15:04"))
+	}
+	next, ok := p.nextAllowed(when)
+	if !ok {
+		return when, "", fmt.Errorf("%s at %s and no allowed time follows", reason, when.Format("2006-01-02 15:04"))
+	}
+	return next, fmt.Sprintf("Moved to %s (%s)", next.Format("2006-01-02 15:04"), reason), nil
+}
+
+// ---------- iCalendar ----------
+
+// parseICS extracts the events of an iCalendar file as blackout periods. It
+// understands what holiday calendars use: all-day and timed DTSTART/DTEND
+// (UTC, floating or with a TZID) and SUMMARY. Recurrence rules are ignored.
+func parseICS(data []byte) ([]blackout, error) {
+	// Unfold continuation lines (RFC 5545 section 3.1).
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	data = bytes.ReplaceAll(data, []byte("\n "), nil)
+	data = bytes.ReplaceAll(data, []byte("\n\t"), nil)
+
+	var (
+		blackouts []blackout
+		cur       *blackout
+		allDay    bool
+	)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		name, value, ok := strings.Cut(sc.Text(), ":")
+		if !ok {
+			continue
+		}
+		name, params, _ := strings.Cut(name, ";")
+		switch strings.ToUpper(name) {
+		case "BEGIN":
+			if strings.EqualFold(value, "VEVENT") {
+				cur, allDay = &blackout{}, false
+			}
+		case "END":
+			if !strings.EqualFold(value, "VEVENT") || cur == nil {
+				continue
+			}
+			if cur.start.IsZero() {
+				return nil, fmt.Errorf("event %q has no DTSTART", cur.summary)
+			}
+			if cur.end.IsZero() && allDay {
+				cur.end = cur.start.AddDate(0, 0, 1)
+			}
+			if cur.end.After(cur.start) {
+				blackouts = append(blackouts, *cur)
+			}
+			cur = nil
+		case "SUMMARY":
+			if cur != nil {
+				cur.summary = strings.ReplaceAll(value, `\,`, ",")
+			}
+		case "DTSTART", "DTEND":
+			if cur == nil {
+				continue
+			}
+			t, date, err := parseICSTime(params, value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			if strings.EqualFold(name, "DTSTART") {
+				cur.start, allDay = t, date
+			} else {
+				cur.end = t
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(blackouts, func(i, j int) bool { return blackouts[i].start.Before(blackouts[j].start) })
+	return blackouts, nil
+}
+
+// parseICSTime parses a DTSTART/DTEND value; date is true for all-day values.
+func parseICSTime(params, value string) (t time.Time, date bool, err error) {
+	loc := time.Local
+	for _, param := range strings.Split(params, ";") {
+		k, v, _ := strings.Cut(param, "=")
+		switch strings.ToUpper(k) {
+		case "VALUE":
+			date = strings.EqualFold(v, "DATE")
+		case "TZID":
+			if loc, err = time.LoadLocation(strings.Trim(v, `"`)); err != nil {
+				return t, false, fmt.Errorf("unknown time zone %q", v)
+			}
+		}
+	}
+	switch {
+	case date || len(value) == len("20060102"):
+		t, err = time.ParseInLocation("20060102", value, time.Local)
+		date = true
+	case strings.HasSuffix(value, "Z"):
+		t, err = time.Parse("20060102T150405Z", value)
+	default:
+		t, err = time.ParseInLocation("20060102T150405", value, loc)
+	}
+	if err != nil {
+		return t, false, fmt.Errorf("invalid time %q", value)
+	}
+	return t, date, nil
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCalendar is a holiday calendar as exported by common calendar apps.
+const testCalendar = `BEGIN:VCALENDAR
+VERSION:2.0
+BEGIN:VEVENT
+SUMMARY:Maintenance
+DTSTART:20261026T140000Z
+DTEND:20261026T150000Z
+END:VEVENT
+BEGIN:VEVENT
+SUMMARY:Release freeze\, v2
+DTSTART;VALUE=DATE:20261020
+DTEND;VALUE=DATE:20261022
+END:VEVENT
+BEGIN:VEVENT
+SUMMARY:Company
+  offsite
+DTSTART;TZID=Europe/Berlin:20261023T090000
+DTEND;TZID="Europe/Berlin":20261023T120000
+END:VEVENT
+BEGIN:VEVENT
+SUMMARY:Holiday
+DTSTART;VALUE=DATE:20261102
+END:VEVENT
+BEGIN:VEVENT
+SUMMARY:Empty
+DTSTART:20261103T100000Z
+DTEND:20261103T100000Z
+END:VEVENT
+END:VCALENDAR
+`
+
+// weekdayHours is 09:00 to 17:00, Monday to Friday.
+func weekdayHours(t *testing.T) weeklyWindow {
+	t.Helper()
+	w, err := parseBusinessHours(businessHours{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "09:00", End: "17:00"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func TestParseICS(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	blackouts, err := parseICS([]byte(strings.ReplaceAll(testCalendar, "\n", "\r\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []blackout{
+		{start: localTime(2026, 10, 20, 0, 0), end: localTime(2026, 10, 22, 0, 0), summary: "Release freeze, v2"},
+		{start: time.Date(2026, 10, 23, 9, 0, 0, 0, berlin), end: time.Date(2026, 10, 23, 12, 0, 0, 0, berlin), summary: "Company offsite"},
+		{start: time.Date(2026, 10, 26, 14, 0, 0, 0, time.UTC), end: time.Date(2026, 10, 26, 15, 0, 0, 0, time.UTC), summary: "Maintenance"},
+		// An all-day event without DTEND lasts the day; the empty one is dropped.
+		{start: localTime(2026, 11, 2, 0, 0), end: localTime(2026, 11, 3, 0, 0), summary: "Holiday"},
+	}
+	if len(blackouts) != len(want) {
+		t.Fatalf("got %d blackouts, want %d: %v", len(blackouts), len(want), blackouts)
+	}
+	for i, b := range blackouts {
+		if !b.start.Equal(want[i].start) || !b.end.Equal(want[i].end) || b.summary != want[i].summary {
+			t.Errorf("blackout %d = %s - %s %q, want %s - %s %q", i, b.start, b.end, b.summary, want[i].start, want[i].end, want[i].summary)
+		}
+	}
+
+	for _, bad := range []string{
+		"BEGIN:VEVENT\nSUMMARY:No start\nEND:VEVENT\n",
+		"BEGIN:VEVENT\nDTSTART;TZID=Mars/Olympus:20261023T090000\nEND:VEVENT\n",
+		"BEGIN:VEVENT\nDTSTART:tomorrow\nEND:VEVENT\n",
+	} {
+		if _, err := parseICS([]byte(bad)); err == nil {
+			t.Errorf("parseICS(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestParseICSTime(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	tests := []struct {
+		params, value string
+		want          time.Time
+		wantDate      bool
+		wantErr       bool
+	}{
+		{params: "VALUE=DATE", value: "20261020", want: localTime(2026, 10, 20, 0, 0), wantDate: true},
+		{value: "20261020", want: localTime(2026, 10, 20, 0, 0), wantDate: true},
+		{value: "20261026T140000Z", want: time.Date(2026, 10, 26, 14, 0, 0, 0, time.UTC)},
+		{value: "20261026T140000", want: localTime(2026, 10, 26, 14, 0)},
+		{params: "TZID=Europe/Berlin", value: "20261023T090000", want: time.Date(2026, 10, 23, 9, 0, 0, 0, berlin)},
+		{params: `TZID="Europe/Berlin"`, value: "20261023T090000", want: time.Date(2026, 10, 23, 9, 0, 0, 0, berlin)},
+		// A UTC time ignores the TZID.
+		{params: "TZID=Europe/Berlin", value: "20261023T090000Z", want: time.Date(2026, 10, 23, 9, 0, 0, 0, time.UTC)},
+		{params: "TZID=Mars/Olympus", value: "20261023T090000", wantErr: true},
+		{params: "VALUE=DATE", value: "2026-10-20", wantErr: true},
+		{value: "20261023T0900", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, date, err := parseICSTime(tt.params, tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseICSTime(%q, %q) = %s, want an error", tt.params, tt.value, got)
+			}
+			continue
+		}
+		if err != nil || !got.Equal(tt.want) || date != tt.wantDate {
+			t.Errorf("parseICSTime(%q, %q) = %s, %v, %v, want %s, %v", tt.params, tt.value, got, date, err, tt.want, tt.wantDate)
+		}
+	}
+}
+
+func TestFreezeCheck(t *testing.T) {
+	policy := &freezePolicy{
+		windows: []weeklyWindow{weekdayHours(t)},
+		blackouts: []blackout{
+			{start: localTime(2026, 10, 20, 0, 0), end: localTime(2026, 10, 21, 0, 0), summary: "Release freeze"},
+			{start: localTime(2026, 10, 22, 9, 0), end: localTime(2026, 10, 22, 11, 0)},
+		},
+	}
+	tests := []struct {
+		name        string
+		when        time.Time
+		want        time.Time
+		wantMessage string
+	}{
+		{"inside business hours", localTime(2026, 10, 14, 10, 0), localTime(2026, 10, 14, 10, 0), ""},
+		{"before the day starts", localTime(2026, 10, 19, 8, 0), localTime(2026, 10, 19, 9, 0), "Moved to 2026-10-19 09:00 (outside business hours)"},
+		{"after the day ends", localTime(2026, 10, 14, 17, 0), localTime(2026, 10, 15, 9, 0), "Moved to 2026-10-15 09:00 (outside business hours)"},
+		{"friday evening", localTime(2026, 10, 16, 17, 30), localTime(2026, 10, 19, 9, 0), "Moved to 2026-10-19 09:00 (outside business hours)"},
+		{"saturday", localTime(2026, 10, 17, 12, 0), localTime(2026, 10, 19, 9, 0), "Moved to 2026-10-19 09:00 (outside business hours)"},
+		{"all-day freeze", localTime(2026, 10, 20, 10, 0), localTime(2026, 10, 21, 9, 0), "Moved to 2026-10-21 09:00 (merge freeze: Release freeze)"},
+		{"unnamed freeze", localTime(2026, 10, 22, 9, 30), localTime(2026, 10, 22, 11, 0), "Moved to 2026-10-22 11:00 (merge freeze)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, message, err := policy.check(tt.when)
+			if err != nil || !got.Equal(tt.want) || message != tt.wantMessage {
+				t.Errorf("check(%s) = %s, %q, %v, want %s, %q", tt.when, got, message, err, tt.want, tt.wantMessage)
+			}
+
+			refusing := *policy
+			refusing.refuse = true
+			got, message, err = refusing.check(tt.when)
+			if tt.wantMessage == "" {
+				if err != nil || !got.Equal(tt.when) || message != "" {
+					t.Errorf("refusing check(%s) = %s, %q, %v", tt.when, got, message, err)
+				}
+			} else if err == nil {
+				t.Errorf("refusing check(%s) = %s, %q, want an error", tt.when, got, message)
+			}
+		})
+	}
+
+	var none *freezePolicy
+	when := localTime(2026, 10, 17, 3, 0)
+	if got, message, err := none.check(when); err != nil || !got.Equal(when) || message != "" {
+		t.Errorf("nil policy check(%s) = %s, %q, %v", when, got, message, err)
+	}
+}
+
+func TestNextWindowStart(t *testing.T) {
+	saturday, err := parseBusinessHours(businessHours{Days: []string{"Sat"}, Start: "10:00", End: "12:00"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := &freezePolicy{windows: []weeklyWindow{weekdayHours(t), saturday}}
+	tests := []struct {
+		from, want time.Time
+	}{
+		{localTime(2026, 10, 14, 8, 0), localTime(2026, 10, 14, 9, 0)},
+		// Strictly after: a window starting right now is the next day's.
+		{localTime(2026, 10, 14, 9, 0), localTime(2026, 10, 15, 9, 0)},
+		{localTime(2026, 10, 16, 17, 0), localTime(2026, 10, 17, 10, 0)},
+		{localTime(2026, 10, 17, 10, 30), localTime(2026, 10, 19, 9, 0)},
+	}
+	for _, tt := range tests {
+		if got, ok := policy.nextWindowStart(tt.from); !ok || !got.Equal(tt.want) {
+			t.Errorf("nextWindowStart(%s) = %s, %v, want %s", tt.from, got, ok, tt.want)
+		}
+	}
+
+	if got, ok := (&freezePolicy{}).nextWindowStart(localTime(2026, 10, 14, 8, 0)); ok {
+		t.Errorf("nextWindowStart without windows = %s", got)
+	}
+}
+
+func TestNextAllowed(t *testing.T) {
+	// A freeze over the weekend runs into a Monday morning one.
+	policy := &freezePolicy{
+		windows: []weeklyWindow{weekdayHours(t)},
+		blackouts: []blackout{
+			{start: localTime(2026, 10, 16, 12, 0), end: localTime(2026, 10, 19, 10, 0)},
+			{start: localTime(2026, 10, 19, 10, 0), end: localTime(2026, 10, 19, 12, 0)},
+		},
+	}
+	if got, ok := policy.nextAllowed(localTime(2026, 10, 16, 13, 0)); !ok || !got.Equal(localTime(2026, 10, 19, 12, 0)) {
+		t.Errorf("nextAllowed = %s, %v, want Monday 12:00", got, ok)
+	}
+	if got, ok := policy.nextAllowed(localTime(2026, 10, 16, 11, 0)); !ok || !got.Equal(localTime(2026, 10, 16, 11, 0)) {
+		t.Errorf("nextAllowed of an allowed time = %s, %v", got, ok)
+	}
+
+	// A freeze ending outside business hours waits for the next window.
+	policy.blackouts = []blackout{{start: localTime(2026, 10, 16, 12, 0), end: localTime(2026, 10, 17, 0, 0)}}
+	if got, ok := policy.nextAllowed(localTime(2026, 10, 16, 13, 0)); !ok || !got.Equal(localTime(2026, 10, 19, 9, 0)) {
+		t.Errorf("nextAllowed = %s, %v, want Monday 09:00", got, ok)
+	}
+}
+
+func TestNewFreezePolicy(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "holidays.ics"), []byte(testCalendar), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The calendar path is relative to the config directory.
+	policy, err := newFreezePolicy(freezeConfig{Calendar: "holidays.ics", Action: "refuse"}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !policy.refuse || len(policy.windows) != 0 || len(policy.blackouts) != 4 {
+		t.Errorf("policy = %+v", policy)
+	}
+
+	if policy, err := newFreezePolicy(freezeConfig{}, dir); policy != nil || err != nil {
+		t.Errorf("empty config = %v, %v, want no policy", policy, err)
+	}
+
+	for _, fc := range []freezeConfig{
+		{Calendar: "holidays.ics", Action: "postpone"},
+		{Calendar: "missing.ics"},
+		{BusinessHours: []businessHours{{Start: "09:00", End: "17:00"}}},
+		{BusinessHours: []businessHours{{Days: []string{"someday"}, Start: "09:00", End: "17:00"}}},
+		{BusinessHours: []businessHours{{Days: []string{"mon"}, Start: "17:00", End: "09:00"}}},
+		{BusinessHours: []businessHours{{Days: []string{"mon"}, Start: "9am", End: "17:00"}}},
+	} {
+		if _, err := newFreezePolicy(fc, dir); err == nil {
+			t.Errorf("newFreezePolicy(%+v) succeeded", fc)
+		}
+	}
+}
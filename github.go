@@ -0,0 +1,472 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// ---------- GitHub backend ----------
+
+// GitHub is everything the scheduler needs from GitHub. An implementation is
+// bound to one repository. ghCLI and apiClient are the production
+// implementations; fakeGitHub is an in-memory stand-in for tests.
+type GitHub interface {
+	// CurrentUser returns the login of the authenticated user.
+	CurrentUser() (string, error)
+	// Repo returns the "owner/name" of the repository.
+	Repo() (string, error)
+	// ListPRs returns the open pull requests, with Repo set.
+	ListPRs() ([]pr, error)
+	// GetPR returns a single pull request.
+	GetPR(number int) (pr, error)
+	// PRState returns OPEN, CLOSED or MERGED.
+	PRState(number int) (string, error)
+	// HeadSHA returns the commit the PR branch currently points at.
+	HeadSHA(number int) (string, error)
+	// Comment posts a comment on the PR.
+	Comment(number int, body string) error
+	// EnableAutoMerge asks GitHub to merge the PR once its requirements pass.
+	// Unless headSHA is empty, GitHub refuses if the branch moved off it.
+	EnableAutoMerge(number int, method mergeMethod, headSHA string) error
+	// DisableAutoMerge switches auto-merge off again.
+	DisableAutoMerge(number int) error
+	// SetBase changes the branch the PR merges into.
+	SetBase(number int, base string) error
+	// UpdateBranch brings the PR branch up to date with its base, by merging
+	// the base into it or, with rebase, rebasing it onto the base.
+	UpdateBranch(number int, rebase bool) error
+	// CheckStatus summarises the checks on the PR's head commit.
+	CheckStatus(number int) (checksResult, error)
+	// ReviewDecision returns APPROVED, CHANGES_REQUESTED, REVIEW_REQUIRED, or
+	// "" when the repository requires no review.
+	ReviewDecision(number int) (string, error)
+	// PRDetails returns the PR with its checks, reviews, labels and diff
+	// stats, for the detail pane.
+	PRDetails(number int) (prDetails, error)
+}
+
+// checksResult summarises the checks on a commit.
+type checksResult struct {
+	State   string   // SUCCESS, PENDING, FAILURE, or "" if there are none
+	Failing []string // names of the failed checks
+	Pending []string // names of the unfinished checks
+}
+
+// prDetails is everything the detail pane shows about a PR, beyond what the
+// list shows.
+type prDetails struct {
+	PR           pr
+	Checks       []checkRun
+	Reviews      []review // the latest review of each reviewer
+	Additions    int
+	Deletions    int
+	ChangedFiles int
+	Mergeable    string // MERGEABLE, CONFLICTING or UNKNOWN
+}
+
+// checkRun is a check run or commit status on the PR's head commit.
+type checkRun struct {
+	Name   string
+	Result string // its conclusion, e.g. SUCCESS or FAILURE, or PENDING
+}
+
+// review is a reviewer's latest review.
+type review struct {
+	Author string
+	State  string // APPROVED, CHANGES_REQUESTED, COMMENTED or DISMISSED
+}
+
+// freshHeads returns prs with the commits their branches point at now. A
+// schedule only merges the head confirmed when it was created, so that must
+// not come from a PR list loaded a while ago; a PR whose head cannot be looked
+// up is not scheduled at all.
+func freshHeads(github func(repo string) GitHub, prs []pr) ([]pr, error) {
+	fresh := make([]pr, len(prs))
+	for i, p := range prs {
+		sha, err := github(p.Repo).HeadSHA(p.Number)
+		if err == nil && sha == "" {
+			err = errors.New("no commit found")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up the head commit of PR %s: %w", p.ref(), err)
+		}
+		p.HeadSHA = sha
+		fresh[i] = p
+	}
+	return fresh, nil
+}
+
+// ---------- gh CLI implementation ----------
+
+// ghCLI shells out to the gh CLI.
+type ghCLI struct {
+	repo string // "owner/name"; "" for the repository of the working directory
+}
+
+func newGHCLI(repo string) ghCLI {
+	return ghCLI{repo: repo}
+}
+
+// run executes gh and returns its output, folding the output into the error
+// when gh fails.
+func (g ghCLI) run(what string, args ...string) ([]byte, error) {
+	cmd := exec.Command("gh", args...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return out, fmt.Errorf("%s failed: %w (%s)", what, err, string(out))
+	}
+	return out, nil
+}
+
+// The PR fields requested from gh and their JSON shape.
+const ghPRFields = "number,title,author,state,isDraft,mergeStateStatus,url,baseRefName,headRefName,headRefOid,labels,reviewDecision,assignees,reviewRequests"
+
+type ghPR struct {
+	Number           int                `json:"number"`
+	Title            string             `json:"title"`
+	State            string             `json:"state"`
+	IsDraft          bool               `json:"isDraft"`
+	URL              string             `json:"url"`
+	Author           ghUser             `json:"author"`
+	MergeStateStatus string             `json:"mergeStateStatus"`
+	BaseRefName      string             `json:"baseRefName"`
+	HeadRefName      string             `json:"headRefName"`
+	HeadRefOid       string             `json:"headRefOid"`
+	Labels           ghList[ghLabel]    `json:"labels"`
+	ReviewDecision   string             `json:"reviewDecision"`
+	Assignees        ghList[ghUser]     `json:"assignees"`
+	ReviewRequests   ghList[ghReviewer] `json:"reviewRequests"`
+}
+
+type ghUser struct {
+	Login string `json:"login"`
+}
+
+type ghLabel struct {
+	Name string `json:"name"`
+}
+
+// ghReviewer is a user (login) or a team (name) asked for a review.
+type ghReviewer struct {
+	Login string `json:"login"`
+	Name  string `json:"name"`
+	// RequestedReviewer holds the reviewer in GraphQL review requests.
+	RequestedReviewer *ghReviewer `json:"requestedReviewer"`
+}
+
+func (r ghReviewer) name() string {
+	if r.RequestedReviewer != nil {
+		return r.RequestedReviewer.name()
+	}
+	if r.Login != "" {
+		return r.Login
+	}
+	return r.Name
+}
+
+// ghList decodes a list printed by `gh --json` as well as the same list as
+// a GraphQL connection, {"nodes": [...]}.
+type ghList[T any] []T
+
+func (l *ghList[T]) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '{' {
+		var conn struct {
+			Nodes []T `json:"nodes"`
+		}
+		if err := json.Unmarshal(data, &conn); err != nil {
+			return err
+		}
+		*l = conn.Nodes
+		return nil
+	}
+	return json.Unmarshal(data, (*[]T)(l))
+}
+
+func (r ghPR) toPR(repo string) pr {
+	ms := r.MergeStateStatus
+	if ms == "" {
+		ms = "unknown"
+	}
+	p := pr{
+		Repo:           repo,
+		Number:         r.Number,
+		Title:          r.Title,
+		Author:         r.Author.Login,
+		State:          r.State,
+		Draft:          r.IsDraft,
+		MergeState:     ms,
+		URL:            r.URL,
+		BaseRef:        r.BaseRefName,
+		HeadRef:        r.HeadRefName,
+		HeadSHA:        r.HeadRefOid,
+		ReviewDecision: r.ReviewDecision,
+	}
+	for _, l := range r.Labels {
+		p.Labels = append(p.Labels, l.Name)
+	}
+	for _, a := range r.Assignees {
+		p.Assignees = append(p.Assignees, a.Login)
+	}
+	for _, rr := range r.ReviewRequests {
+		if name := rr.name(); name != "" {
+			p.ReviewRequests = append(p.ReviewRequests, name)
+		}
+	}
+	return p
+}
+
+func (g ghCLI) CurrentUser() (string, error) {
+	out, err := g.run("gh api user", "api", "user", "--jq", ".login")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (g ghCLI) Repo() (string, error) {
+	if g.repo != "" {
+		return g.repo, nil
+	}
+	out, err := g.run("gh repo view", "repo", "view", "--json", "nameWithOwner", "--jq", ".nameWithOwner")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// pr runs a `gh pr` subcommand against the repository.
+func (g ghCLI) pr(what string, args ...string) ([]byte, error) {
+	if g.repo != "" {
+		args = append(args, "--repo", g.repo)
+	}
+	return g.run(what, append([]string{"pr"}, args...)...)
+}
+
+func (g ghCLI) ListPRs() ([]pr, error) {
+	repo, err := g.Repo()
+	if err != nil {
+		return nil, err
+	}
+	out, err := g.pr("gh pr list", "list",
+		"--state", "open",
+		"--json", ghPRFields,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw []ghPR
+	if err := json.Unmarshal(out, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse gh pr list output: %w", err)
+	}
+
+	prs := make([]pr, 0, len(raw))
+	for _, r := range raw {
+		prs = append(prs, r.toPR(repo))
+	}
+	return prs, nil
+}
+
+func (g ghCLI) GetPR(number int) (pr, error) {
+	repo, err := g.Repo()
+	if err != nil {
+		return pr{}, err
+	}
+	out, err := g.pr("gh pr view", "view", strconv.Itoa(number), "--json", ghPRFields)
+	if err != nil {
+		return pr{}, err
+	}
+	var raw ghPR
+	if err := json.Unmarshal(out, &raw); err != nil {
+		return pr{}, fmt.Errorf("failed to parse gh pr view output: %w", err)
+	}
+	return raw.toPR(repo), nil
+}
+
+func (g ghCLI) PRState(number int) (string, error) {
+	out, err := g.pr("gh pr view", "view", strconv.Itoa(number), "--json", "state", "--jq", ".state")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (g ghCLI) HeadSHA(number int) (string, error) {
+	out, err := g.pr("gh pr view", "view", strconv.Itoa(number), "--json", "headRefOid", "--jq", ".headRefOid")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (g ghCLI) Comment(number int, body string) error {
+	_, err := g.pr("gh pr comment", "comment", strconv.Itoa(number), "--body", body)
+	return err
+}
+
+func (g ghCLI) EnableAutoMerge(number int, method mergeMethod, headSHA string) error {
+	args := []string{"merge", "--auto", method.ghFlag()}
+	if headSHA != "" {
+		args = append(args, "--match-head-commit", headSHA)
+	}
+	_, err := g.pr("gh pr merge", append(args, strconv.Itoa(number))...)
+	return err
+}
+
+func (g ghCLI) DisableAutoMerge(number int) error {
+	_, err := g.pr("gh pr merge --disable-auto", "merge", "--disable-auto", strconv.Itoa(number))
+	return err
+}
+
+func (g ghCLI) SetBase(number int, base string) error {
+	_, err := g.pr("gh pr edit", "edit", strconv.Itoa(number), "--base", base)
+	return err
+}
+
+func (g ghCLI) UpdateBranch(number int, rebase bool) error {
+	args := []string{"update-branch", strconv.Itoa(number)}
+	if rebase {
+		args = append(args, "--rebase")
+	}
+	_, err := g.pr("gh pr update-branch", args...)
+	return err
+}
+
+// ghCheck is an entry of `gh pr view --json statusCheckRollup`: either a
+// check run (name, status and conclusion) or a commit status (context and
+// state).
+type ghCheck struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Conclusion string `json:"conclusion"`
+	Context    string `json:"context"`
+	State      string `json:"state"`
+}
+
+// result returns the name of the check and its result: for a check run only
+// its conclusion once completed, else PENDING.
+func (c ghCheck) result() checkRun {
+	if c.Status == "" {
+		return checkRun{Name: c.Context, Result: c.State} // commit status
+	}
+	if c.Status != "COMPLETED" {
+		return checkRun{Name: c.Name, Result: "PENDING"}
+	}
+	return checkRun{Name: c.Name, Result: c.Conclusion}
+}
+
+// The extra fields `gh pr view` reports for the detail pane, and their JSON
+// shape.
+const ghDetailFields = "statusCheckRollup,latestReviews,additions,deletions,changedFiles,mergeable"
+
+type ghPRDetails struct {
+	ghPR
+	StatusCheckRollup []ghCheck        `json:"statusCheckRollup"`
+	LatestReviews     ghList[ghReview] `json:"latestReviews"`
+	Additions         int              `json:"additions"`
+	Deletions         int              `json:"deletions"`
+	ChangedFiles      int              `json:"changedFiles"`
+	Mergeable         string           `json:"mergeable"`
+}
+
+type ghReview struct {
+	Author ghUser `json:"author"`
+	State  string `json:"state"`
+}
+
+func (r ghPRDetails) toDetails(repo string) prDetails {
+	d := prDetails{
+		PR:           r.toPR(repo),
+		Additions:    r.Additions,
+		Deletions:    r.Deletions,
+		ChangedFiles: r.ChangedFiles,
+		Mergeable:    r.Mergeable,
+	}
+	for _, c := range r.StatusCheckRollup {
+		d.Checks = append(d.Checks, c.result())
+	}
+	for _, rv := range r.LatestReviews {
+		d.Reviews = append(d.Reviews, review{Author: rv.Author.Login, State: rv.State})
+	}
+	return d
+}
+
+func (g ghCLI) CheckStatus(number int) (checksResult, error) {
+	out, err := g.pr("gh pr view", "view", strconv.Itoa(number), "--json", "statusCheckRollup")
+	if err != nil {
+		return checksResult{}, err
+	}
+	var raw struct {
+		StatusCheckRollup []ghCheck `json:"statusCheckRollup"`
+	}
+	if err := json.Unmarshal(out, &raw); err != nil {
+		return checksResult{}, fmt.Errorf("failed to parse gh pr view output: %w", err)
+	}
+	return rollupChecks(raw.StatusCheckRollup), nil
+}
+
+func (g ghCLI) ReviewDecision(number int) (string, error) {
+	out, err := g.pr("gh pr view", "view", strconv.Itoa(number), "--json", "reviewDecision", "--jq", ".reviewDecision")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (g ghCLI) PRDetails(number int) (prDetails, error) {
+	repo, err := g.Repo()
+	if err != nil {
+		return prDetails{}, err
+	}
+	out, err := g.pr("gh pr view", "view", strconv.Itoa(number), "--json", ghPRFields+","+ghDetailFields)
+	if err != nil {
+		return prDetails{}, err
+	}
+	var raw ghPRDetails
+	if err := json.Unmarshal(out, &raw); err != nil {
+		return prDetails{}, fmt.Errorf("failed to parse gh pr view output: %w", err)
+	}
+	return raw.toDetails(repo), nil
+}
+
+// checkOutcome sorts a check result into SUCCESS, FAILURE or PENDING.
+func checkOutcome(result string) string {
+	switch result {
+	case "FAILURE", "ERROR", "CANCELLED", "TIMED_OUT", "ACTION_REQUIRED", "STARTUP_FAILURE":
+		return "FAILURE"
+	case "SUCCESS", "NEUTRAL", "SKIPPED":
+		return "SUCCESS"
+	}
+	return "PENDING"
+}
+
+// rollupChecks combines checks the way GitHub's status rollup does: any
+// failure fails, else anything unfinished is pending.
+func rollupChecks(checks []ghCheck) checksResult {
+	var r checksResult
+	if len(checks) == 0 {
+		return r
+	}
+	for _, c := range checks {
+		check := c.result()
+		switch checkOutcome(check.Result) {
+		case "FAILURE":
+			r.Failing = append(r.Failing, check.Name)
+		case "PENDING":
+			r.Pending = append(r.Pending, check.Name)
+		}
+	}
+	switch {
+	case len(r.Failing) > 0:
+		r.State = "FAILURE"
+	case len(r.Pending) > 0:
+		r.State = "PENDING"
+	default:
+		r.State = "SUCCESS"
+	}
+	return r
+}
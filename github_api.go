@@ -0,0 +1,580 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ---------- GitHub REST/GraphQL implementation ----------
+
+const defaultAPIURL = "https://api.github.com"
+
+// apiClient talks to the GitHub REST and GraphQL APIs directly, without
+// starting a gh process per call.
+type apiClient struct {
+	baseURL    string // REST root, e.g. https://api.github.com
+	graphqlURL string
+	token      string
+	owner      string
+	name       string
+	http       *http.Client
+}
+
+// apiError is a non-2xx answer from the REST API.
+type apiError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("GitHub API returned %d: %s", e.StatusCode, e.Message)
+}
+
+// newAPIClient builds a client for the "owner/name" repository, or for the
+// checkout in the working directory if repo is empty. An empty baseURL means
+// api.github.com; for GitHub Enterprise pass the https://host/api/v3 root.
+func newAPIClient(baseURL, repo string) (*apiClient, error) {
+	c, err := newUserAPIClient(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if repo != "" {
+		var ok bool
+		if c.owner, c.name, ok = strings.Cut(repo, "/"); !ok {
+			return nil, fmt.Errorf("invalid repository %q, want owner/name", repo)
+		}
+	} else if c.owner, c.name, err = repoFromGitRemote(""); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// newUserAPIClient builds a client bound to no repository, which is enough
+// for CurrentUser.
+func newUserAPIClient(baseURL string) (*apiClient, error) {
+	if baseURL == "" {
+		baseURL = defaultAPIURL
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid API URL %q: %w", baseURL, err)
+	}
+	host := u.Hostname()
+	if host == "api.github.com" {
+		host = "github.com"
+	}
+
+	token, err := githubToken(host)
+	if err != nil {
+		return nil, err
+	}
+	return &apiClient{
+		baseURL:    baseURL,
+		graphqlURL: graphqlURLFor(baseURL),
+		token:      token,
+		http:       &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// graphqlURLFor derives the GraphQL endpoint from the REST root: api.github.com
+// serves it at /graphql, GitHub Enterprise at /api/graphql next to /api/v3.
+func graphqlURLFor(baseURL string) string {
+	if root, ok := strings.CutSuffix(baseURL, "/v3"); ok {
+		return root + "/graphql"
+	}
+	return baseURL + "/graphql"
+}
+
+// githubToken finds a token the same way gh does: GH_TOKEN, GITHUB_TOKEN,
+// then the oauth_token stored in gh's hosts.yml.
+func githubToken(host string) (string, error) {
+	for _, env := range []string{"GH_TOKEN", "GITHUB_TOKEN"} {
+		if token := os.Getenv(env); token != "" {
+			return token, nil
+		}
+	}
+
+	dir := os.Getenv("GH_CONFIG_DIR")
+	if dir == "" {
+		if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+			dir = filepath.Join(xdg, "gh")
+		} else {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", fmt.Errorf("failed to locate home directory: %w", err)
+			}
+			dir = filepath.Join(home, ".config", "gh")
+		}
+	}
+	f, err := os.Open(filepath.Join(dir, "hosts.yml"))
+	if err != nil {
+		return "", fmt.Errorf("no GitHub token: set GH_TOKEN or GITHUB_TOKEN, or log in with gh (%w)", err)
+	}
+	defer f.Close()
+
+	// hosts.yml is a small YAML map of host -> settings. Only the top-level
+	// oauth_token of our host is needed, so a line scan is enough; the
+	// per-account settings nested below it (under "users:") are skipped.
+	inHost := false
+	indent := 0 // of the host's own settings
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		if !strings.HasPrefix(line, " ") {
+			inHost = strings.TrimSuffix(strings.TrimSpace(line), ":") == host
+			indent = 0
+			continue
+		}
+		depth := len(line) - len(strings.TrimLeft(line, " "))
+		if indent == 0 {
+			indent = depth
+		}
+		if depth != indent {
+			continue
+		}
+		if key, value, ok := strings.Cut(strings.TrimSpace(line), ":"); inHost && ok && key == "oauth_token" {
+			if token := strings.Trim(strings.TrimSpace(value), `"'`); token != "" {
+				return token, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no GitHub token for %s: set GH_TOKEN or GITHUB_TOKEN (gh may keep it in the system keyring)", host)
+}
+
+var remoteRepoRe = regexp.MustCompile(`[:/]([^/:]+)/([^/]+?)(?:\.git)?/?$`)
+
+// repoFromGitRemote reads owner and name from the origin remote of the
+// checkout in dir ("" for the working directory).
+func repoFromGitRemote(dir string) (owner, name string, err error) {
+	cmd := exec.Command("git", "remote", "get-url", "origin")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read origin remote: %w (%s)", err, strings.TrimSpace(string(out)))
+	}
+	m := remoteRepoRe.FindStringSubmatch(strings.TrimSpace(string(out)))
+	if m == nil {
+		return "", "", fmt.Errorf("cannot tell the GitHub repository from remote %q", strings.TrimSpace(string(out)))
+	}
+	return m[1], m[2], nil
+}
+
+// do sends a request and decodes the JSON answer into out (if not nil).
+func (c *apiClient) do(method, endpoint string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, endpoint, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 300 {
+		var payload struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &payload) != nil || payload.Message == "" {
+			payload.Message = strings.TrimSpace(string(data))
+		}
+		return &apiError{StatusCode: resp.StatusCode, Message: payload.Message}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to parse GitHub API response: %w", err)
+	}
+	return nil
+}
+
+func (c *apiClient) rest(method, path string, body, out any) error {
+	return c.do(method, c.baseURL+path, body, out)
+}
+
+func (c *apiClient) repoPath(format string, args ...any) string {
+	return fmt.Sprintf("/repos/%s/%s", url.PathEscape(c.owner), url.PathEscape(c.name)) + fmt.Sprintf(format, args...)
+}
+
+// graphql runs a query and decodes its "data" into out.
+func (c *apiClient) graphql(query string, variables map[string]any, out any) error {
+	var resp struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	body := map[string]any{"query": query, "variables": variables}
+	if err := c.do(http.MethodPost, c.graphqlURL, body, &resp); err != nil {
+		return err
+	}
+	if len(resp.Errors) > 0 {
+		msgs := make([]string, len(resp.Errors))
+		for i, e := range resp.Errors {
+			msgs[i] = e.Message
+		}
+		return fmt.Errorf("GitHub GraphQL error: %s", strings.Join(msgs, "; "))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(resp.Data, out)
+}
+
+// The GraphQL shape of a PR; the field names match `gh pr list --json`, so it
+// decodes into ghPR.
+const graphqlPRFields = `number title state isDraft url mergeStateStatus baseRefName headRefName headRefOid author { login }
+      reviewDecision labels(first: 20) { nodes { name } } assignees(first: 20) { nodes { login } }
+      reviewRequests(first: 20) { nodes { requestedReviewer { ... on User { login } ... on Team { name } } } }`
+
+func (c *apiClient) CurrentUser() (string, error) {
+	var user struct {
+		Login string `json:"login"`
+	}
+	if err := c.rest(http.MethodGet, "/user", nil, &user); err != nil {
+		return "", err
+	}
+	return user.Login, nil
+}
+
+func (c *apiClient) Repo() (string, error) {
+	return c.owner + "/" + c.name, nil
+}
+
+func (c *apiClient) ListPRs() ([]pr, error) {
+	const query = `query($owner: String!, $name: String!, $after: String) {
+  repository(owner: $owner, name: $name) {
+    pullRequests(states: OPEN, first: 100, after: $after, orderBy: {field: CREATED_AT, direction: DESC}) {
+      nodes { ` + graphqlPRFields + ` }
+      pageInfo { hasNextPage endCursor }
+    }
+  }
+}`
+	var prs []pr
+	variables := map[string]any{"owner": c.owner, "name": c.name, "after": nil}
+	for {
+		var data struct {
+			Repository struct {
+				PullRequests struct {
+					Nodes    []ghPR `json:"nodes"`
+					PageInfo struct {
+						HasNextPage bool   `json:"hasNextPage"`
+						EndCursor   string `json:"endCursor"`
+					} `json:"pageInfo"`
+				} `json:"pullRequests"`
+			} `json:"repository"`
+		}
+		if err := c.graphql(query, variables, &data); err != nil {
+			return nil, err
+		}
+		page := data.Repository.PullRequests
+		for _, r := range page.Nodes {
+			prs = append(prs, r.toPR(c.owner+"/"+c.name))
+		}
+		if !page.PageInfo.HasNextPage {
+			return prs, nil
+		}
+		variables["after"] = page.PageInfo.EndCursor
+	}
+}
+
+func (c *apiClient) GetPR(number int) (pr, error) {
+	const query = `query($owner: String!, $name: String!, $number: Int!) {
+  repository(owner: $owner, name: $name) {
+    pullRequest(number: $number) { ` + graphqlPRFields + ` }
+  }
+}`
+	var data struct {
+		Repository struct {
+			PullRequest *ghPR `json:"pullRequest"`
+		} `json:"repository"`
+	}
+	variables := map[string]any{"owner": c.owner, "name": c.name, "number": number}
+	if err := c.graphql(query, variables, &data); err != nil {
+		return pr{}, err
+	}
+	if data.Repository.PullRequest == nil {
+		return pr{}, fmt.Errorf("PR #%d not found in %s/%s", number, c.owner, c.name)
+	}
+	return data.Repository.PullRequest.toPR(c.owner + "/" + c.name), nil
+}
+
+// restPR is the subset of the REST pull request object the client uses.
+type restPR struct {
+	NodeID string `json:"node_id"`
+	State  string `json:"state"` // open or closed
+	Merged bool   `json:"merged"`
+	Head   struct {
+		SHA string `json:"sha"`
+	} `json:"head"`
+}
+
+func (c *apiClient) getRESTPR(number int) (restPR, error) {
+	var p restPR
+	err := c.rest(http.MethodGet, c.repoPath("/pulls/%d", number), nil, &p)
+	return p, err
+}
+
+func (c *apiClient) PRState(number int) (string, error) {
+	p, err := c.getRESTPR(number)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case p.Merged:
+		return "MERGED", nil
+	case p.State == "closed":
+		return "CLOSED", nil
+	}
+	return "OPEN", nil
+}
+
+func (c *apiClient) HeadSHA(number int) (string, error) {
+	p, err := c.getRESTPR(number)
+	if err != nil {
+		return "", err
+	}
+	return p.Head.SHA, nil
+}
+
+func (c *apiClient) Comment(number int, body string) error {
+	return c.rest(http.MethodPost, c.repoPath("/issues/%d/comments", number), map[string]string{"body": body}, nil)
+}
+
+// GitHub refuses to enable auto-merge on a PR that can already be merged,
+// with an error mentioning its "clean status".
+const cleanStatusMessage = "clean status"
+
+func (c *apiClient) EnableAutoMerge(number int, method mergeMethod, headSHA string) error {
+	p, err := c.getRESTPR(number)
+	if err != nil {
+		return err
+	}
+	const mutation = `mutation($id: ID!, $method: PullRequestMergeMethod!, $head: GitObjectID) {
+  enablePullRequestAutoMerge(input: {pullRequestId: $id, mergeMethod: $method, expectedHeadOid: $head}) { clientMutationId }
+}`
+	variables := map[string]any{"id": p.NodeID, "method": strings.ToUpper(method.label()), "head": nil}
+	if headSHA != "" {
+		variables["head"] = headSHA
+	}
+	err = c.graphql(mutation, variables, nil)
+	if err == nil || !strings.Contains(err.Error(), cleanStatusMessage) {
+		return err
+	}
+
+	// Nothing left to wait for: merge right away, as `gh pr merge --auto` does.
+	body := map[string]string{"merge_method": method.label()}
+	if headSHA != "" {
+		body["sha"] = headSHA
+	}
+	return c.rest(http.MethodPut, c.repoPath("/pulls/%d/merge", number), body, nil)
+}
+
+func (c *apiClient) DisableAutoMerge(number int) error {
+	p, err := c.getRESTPR(number)
+	if err != nil {
+		return err
+	}
+	const mutation = `mutation($id: ID!) {
+  disablePullRequestAutoMerge(input: {pullRequestId: $id}) { clientMutationId }
+}`
+	return c.graphql(mutation, map[string]any{"id": p.NodeID}, nil)
+}
+
+func (c *apiClient) SetBase(number int, base string) error {
+	return c.rest(http.MethodPatch, c.repoPath("/pulls/%d", number), map[string]string{"base": base}, nil)
+}
+
+func (c *apiClient) UpdateBranch(number int, rebase bool) error {
+	p, err := c.getRESTPR(number)
+	if err != nil {
+		return err
+	}
+	method := "MERGE"
+	if rebase {
+		method = "REBASE"
+	}
+	const mutation = `mutation($id: ID!, $method: PullRequestBranchUpdateMethod!) {
+  updatePullRequestBranch(input: {pullRequestId: $id, updateMethod: $method}) { clientMutationId }
+}`
+	return c.graphql(mutation, map[string]any{"id": p.NodeID, "method": method}, nil)
+}
+
+func (c *apiClient) CheckStatus(number int) (checksResult, error) {
+	// The contexts decode into ghCheck, as with `gh pr view`.
+	const query = `query($owner: String!, $name: String!, $number: Int!) {
+  repository(owner: $owner, name: $name) {
+    pullRequest(number: $number) {
+      commits(last: 1) { nodes { commit { statusCheckRollup {
+        contexts(first: 100) { nodes {
+          ... on CheckRun { name status conclusion }
+          ... on StatusContext { context state }
+        } }
+      } } } }
+    }
+  }
+}`
+	var data struct {
+		Repository struct {
+			PullRequest *struct {
+				Commits struct {
+					Nodes []struct {
+						Commit struct {
+							StatusCheckRollup *struct {
+								Contexts struct {
+									Nodes []ghCheck `json:"nodes"`
+								} `json:"contexts"`
+							} `json:"statusCheckRollup"`
+						} `json:"commit"`
+					} `json:"nodes"`
+				} `json:"commits"`
+			} `json:"pullRequest"`
+		} `json:"repository"`
+	}
+	variables := map[string]any{"owner": c.owner, "name": c.name, "number": number}
+	if err := c.graphql(query, variables, &data); err != nil {
+		return checksResult{}, err
+	}
+	if data.Repository.PullRequest == nil {
+		return checksResult{}, fmt.Errorf("PR #%d not found in %s/%s", number, c.owner, c.name)
+	}
+	nodes := data.Repository.PullRequest.Commits.Nodes
+	if len(nodes) == 0 || nodes[0].Commit.StatusCheckRollup == nil {
+		return checksResult{}, nil
+	}
+	return rollupChecks(nodes[0].Commit.StatusCheckRollup.Contexts.Nodes), nil
+}
+
+func (c *apiClient) ReviewDecision(number int) (string, error) {
+	const query = `query($owner: String!, $name: String!, $number: Int!) {
+  repository(owner: $owner, name: $name) {
+    pullRequest(number: $number) { reviewDecision }
+  }
+}`
+	var data struct {
+		Repository struct {
+			PullRequest *struct {
+				ReviewDecision *string `json:"reviewDecision"`
+			} `json:"pullRequest"`
+		} `json:"repository"`
+	}
+	variables := map[string]any{"owner": c.owner, "name": c.name, "number": number}
+	if err := c.graphql(query, variables, &data); err != nil {
+		return "", err
+	}
+	if data.Repository.PullRequest == nil {
+		return "", fmt.Errorf("PR #%d not found in %s/%s", number, c.owner, c.name)
+	}
+	if d := data.Repository.PullRequest.ReviewDecision; d != nil {
+		return *d, nil
+	}
+	return "", nil
+}
+
+func (c *apiClient) PRDetails(number int) (prDetails, error) {
+	const query = `query($owner: String!, $name: String!, $number: Int!) {
+  repository(owner: $owner, name: $name) {
+    pullRequest(number: $number) {
+      ` + graphqlPRFields + `
+      mergeable additions deletions changedFiles
+      latestReviews(first: 50) { nodes { author { login } state } }
+      commits(last: 1) { nodes { commit { statusCheckRollup {
+        contexts(first: 100) { nodes {
+          ... on CheckRun { name status conclusion }
+          ... on StatusContext { context state }
+        } }
+      } } } }
+    }
+  }
+}`
+	// Only the check rollup, which gh flattens, differs from ghPRDetails.
+	var data struct {
+		Repository struct {
+			PullRequest *struct {
+				ghPRDetails
+				Commits struct {
+					Nodes []struct {
+						Commit struct {
+							StatusCheckRollup *struct {
+								Contexts struct {
+									Nodes []ghCheck `json:"nodes"`
+								} `json:"contexts"`
+							} `json:"statusCheckRollup"`
+						} `json:"commit"`
+					} `json:"nodes"`
+				} `json:"commits"`
+			} `json:"pullRequest"`
+		} `json:"repository"`
+	}
+	variables := map[string]any{"owner": c.owner, "name": c.name, "number": number}
+	if err := c.graphql(query, variables, &data); err != nil {
+		return prDetails{}, err
+	}
+	p := data.Repository.PullRequest
+	if p == nil {
+		return prDetails{}, fmt.Errorf("PR #%d not found in %s/%s", number, c.owner, c.name)
+	}
+	raw := p.ghPRDetails
+	if nodes := p.Commits.Nodes; len(nodes) > 0 && nodes[0].Commit.StatusCheckRollup != nil {
+		raw.StatusCheckRollup = nodes[0].Commit.StatusCheckRollup.Contexts.Nodes
+	}
+	return raw.toDetails(c.owner + "/" + c.name), nil
+}
+
+// ---------- Unavailable backend ----------
+
+// unavailableGitHub stands in for a backend that could not be set up (no
+// token, no GitHub remote, ...) and reports why on every call.
+type unavailableGitHub struct {
+	err error
+}
+
+func (u unavailableGitHub) CurrentUser() (string, error)                   { return "", u.err }
+func (u unavailableGitHub) Repo() (string, error)                          { return "", u.err }
+func (u unavailableGitHub) ListPRs() ([]pr, error)                         { return nil, u.err }
+func (u unavailableGitHub) GetPR(int) (pr, error)                          { return pr{}, u.err }
+func (u unavailableGitHub) PRState(int) (string, error)                    { return "", u.err }
+func (u unavailableGitHub) HeadSHA(int) (string, error)                    { return "", u.err }
+func (u unavailableGitHub) Comment(int, string) error                      { return u.err }
+func (u unavailableGitHub) EnableAutoMerge(int, mergeMethod, string) error { return u.err }
+func (u unavailableGitHub) DisableAutoMerge(int) error                     { return u.err }
+func (u unavailableGitHub) SetBase(int, string) error                      { return u.err }
+func (u unavailableGitHub) UpdateBranch(int, bool) error                   { return u.err }
+func (u unavailableGitHub) CheckStatus(int) (checksResult, error)          { return checksResult{}, u.err }
+func (u unavailableGitHub) ReviewDecision(int) (string, error)             { return "", u.err }
+func (u unavailableGitHub) PRDetails(int) (prDetails, error)               { return prDetails{}, u.err }
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// newTestAPIClient returns a client for acme/app talking to handler.
+func newTestAPIClient(t *testing.T, handler http.HandlerFunc) *apiClient {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	t.Setenv("GH_TOKEN", "secret")
+	c, err := newAPIClient(srv.URL, "acme/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// graphqlRequest is the body of a GraphQL call.
+type graphqlRequest struct {
+	Query     string         `json:"query"`
+	Variables map[string]any `json:"variables"`
+}
+
+func decodeGraphQL(t *testing.T, r *http.Request) graphqlRequest {
+	t.Helper()
+	if r.Method != http.MethodPost || r.URL.Path != "/graphql" {
+		t.Fatalf("unexpected GraphQL request %s %s", r.Method, r.URL.Path)
+	}
+	var req graphqlRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestAPIClientListPRsPaginates(t *testing.T) {
+	pages := map[any]string{
+		nil: `{"data": {"repository": {"pullRequests": {
+			"nodes": [
+				{"number": 3, "title": "Third", "state": "OPEN", "author": {"login": "bob"}, "labels": {"nodes": [{"name": "bug"}]}},
+				{"number": 2, "title": "Second", "state": "OPEN", "isDraft": true, "mergeStateStatus": "BEHIND", "author": {"login": "carol"}}
+			],
+			"pageInfo": {"hasNextPage": true, "endCursor": "cursor-1"}}}}}`,
+		"cursor-1": `{"data": {"repository": {"pullRequests": {
+			"nodes": [{"number": 1, "title": "First", "state": "OPEN", "author": {"login": "bob"},
+				"reviewRequests": {"nodes": [{"requestedReviewer": {"login": "alice"}}, {"requestedReviewer": {"name": "core"}}]}}],
+			"pageInfo": {"hasNextPage": false, "endCursor": "cursor-2"}}}}}`,
+	}
+	var cursors []any
+	c := newTestAPIClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("Authorization = %q", got)
+		}
+		req := decodeGraphQL(t, r)
+		if req.Variables["owner"] != "acme" || req.Variables["name"] != "app" {
+			t.Errorf("variables = %v", req.Variables)
+		}
+		after := req.Variables["after"]
+		cursors = append(cursors, after)
+		fmt.Fprint(w, pages[after])
+	})
+
+	prs, err := c.ListPRs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []any{nil, "cursor-1"}; !slices.Equal(cursors, want) {
+		t.Errorf("requested pages %v, want %v", cursors, want)
+	}
+	var numbers []int
+	for _, p := range prs {
+		numbers = append(numbers, p.Number)
+		if p.Repo != "acme/app" {
+			t.Errorf("#%d: repo = %q", p.Number, p.Repo)
+		}
+	}
+	if want := []int{3, 2, 1}; !slices.Equal(numbers, want) {
+		t.Fatalf("listed %v, want %v", numbers, want)
+	}
+	if !slices.Equal(prs[0].Labels, []string{"bug"}) || !prs[1].Draft || prs[1].Author != "carol" || prs[1].MergeState != "BEHIND" {
+		t.Errorf("fields not decoded: %+v", prs[:2])
+	}
+	if want := []string{"alice", "core"}; !slices.Equal(prs[2].ReviewRequests, want) {
+		t.Errorf("review requests = %v, want %v", prs[2].ReviewRequests, want)
+	}
+}
+
+func TestAPIClientGetPR(t *testing.T) {
+	tests := []struct {
+		name    string
+		answer  string
+		wantErr string
+	}{
+		{
+			name:   "found",
+			answer: `{"data": {"repository": {"pullRequest": {"number": 7, "title": "Fix", "state": "OPEN", "headRefOid": "abc123", "author": {"login": "bob"}}}}}`,
+		},
+		{
+			name:    "missing",
+			answer:  `{"data": {"repository": {"pullRequest": null}}}`,
+			wantErr: "PR #7 not found in acme/app",
+		},
+		{
+			name:    "GraphQL error",
+			answer:  `{"data": null, "errors": [{"message": "Could not resolve to a PullRequest with the number of 7."}]}`,
+			wantErr: "Could not resolve",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestAPIClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if req := decodeGraphQL(t, r); req.Variables["number"] != float64(7) {
+					t.Errorf("variables = %v", req.Variables)
+				}
+				fmt.Fprint(w, tt.answer)
+			})
+			p, err := c.GetPR(7)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Number != 7 || p.HeadSHA != "abc123" || p.Author != "bob" || p.Repo != "acme/app" {
+				t.Errorf("got %+v", p)
+			}
+		})
+	}
+}
+
+func TestAPIClientEnableAutoMerge(t *testing.T) {
+	tests := []struct {
+		name      string
+		mutation  string // answer to enablePullRequestAutoMerge
+		mergeCode int    // status of PUT /pulls/7/merge, 0 if it must not be called
+		wantErr   string
+	}{
+		{
+			name:     "enabled",
+			mutation: `{"data": {"enablePullRequestAutoMerge": {"clientMutationId": null}}}`,
+		},
+		{
+			name:      "clean status merges right away",
+			mutation:  `{"data": null, "errors": [{"message": "Pull request Pull request is in clean status"}]}`,
+			mergeCode: http.StatusOK,
+		},
+		{
+			name:      "clean status but the merge is refused",
+			mutation:  `{"data": null, "errors": [{"message": "Pull request Pull request is in clean status"}]}`,
+			mergeCode: http.StatusConflict,
+			wantErr:   "409",
+		},
+		{
+			name:     "other errors are returned",
+			mutation: `{"data": null, "errors": [{"message": "Head branch was modified"}]}`,
+			wantErr:  "Head branch was modified",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged := false
+			c := newTestAPIClient(t, func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == http.MethodGet && r.URL.Path == "/repos/acme/app/pulls/7":
+					fmt.Fprint(w, `{"node_id": "PR_7", "state": "open", "head": {"sha": "abc123"}}`)
+				case r.URL.Path == "/graphql":
+					req := decodeGraphQL(t, r)
+					if req.Variables["id"] != "PR_7" || req.Variables["method"] != "SQUASH" || req.Variables["head"] != "abc123" {
+						t.Errorf("variables = %v", req.Variables)
+					}
+					fmt.Fprint(w, tt.mutation)
+				case r.Method == http.MethodPut && r.URL.Path == "/repos/acme/app/pulls/7/merge":
+					merged = true
+					var body map[string]string
+					if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+						t.Fatal(err)
+					}
+					if body["merge_method"] != "squash" || body["sha"] != "abc123" {
+						t.Errorf("merge body = %v", body)
+					}
+					w.WriteHeader(tt.mergeCode)
+					fmt.Fprint(w, `{"message": "Merge conflict"}`)
+				default:
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+					http.NotFound(w, r)
+				}
+			})
+			err := c.EnableAutoMerge(7, mergeMethodSquash, "abc123")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if want := tt.mergeCode != 0; merged != want {
+				t.Errorf("merged right away: %v, want %v", merged, want)
+			}
+		})
+	}
+}
+
+func TestAPIClientErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		body        string
+		wantMessage string
+		wantClass   string
+	}{
+		{"rate limited", http.StatusForbidden, `{"message": "API rate limit exceeded for user ID 1."}`, "API rate limit exceeded for user ID 1.", "rate_limit"},
+		{"server error", http.StatusBadGateway, `<html>Bad Gateway</html>`, "<html>Bad Gateway</html>", "5xx"},
+		{"not found", http.StatusNotFound, `{"message": "Not Found"}`, "Not Found", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestAPIClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			})
+			_, err := c.CurrentUser()
+			var apiErr *apiError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("err = %v, want an apiError", err)
+			}
+			if apiErr.StatusCode != tt.status || apiErr.Message != tt.wantMessage {
+				t.Errorf("got %d %q, want %d %q", apiErr.StatusCode, apiErr.Message, tt.status, tt.wantMessage)
+			}
+			if got := errorClass(err); got != tt.wantClass {
+				t.Errorf("errorClass = %q, want %q", got, tt.wantClass)
+			}
+		})
+	}
+}
+
+func TestGithubToken(t *testing.T) {
+	const hosts = `github.com:
+    user: alice
+    oauth_token: "gho_public"
+    git_protocol: https
+ghe.example.com:
+    users:
+        alice:
+            oauth_token: gho_nested
+    oauth_token: gho_enterprise
+`
+	tests := []struct {
+		name        string
+		env         map[string]string
+		host        string
+		want        string
+		wantErr     bool
+		noHostsFile bool
+	}{
+		{name: "GH_TOKEN first", env: map[string]string{"GH_TOKEN": "from-gh", "GITHUB_TOKEN": "from-github"}, host: "github.com", want: "from-gh"},
+		{name: "GITHUB_TOKEN", env: map[string]string{"GITHUB_TOKEN": "from-github"}, host: "github.com", want: "from-github"},
+		{name: "hosts.yml", host: "github.com", want: "gho_public"},
+		{name: "hosts.yml enterprise host", host: "ghe.example.com", want: "gho_enterprise"},
+		{name: "unknown host", host: "other.example.com", wantErr: true},
+		{name: "no hosts.yml", host: "github.com", wantErr: true, noHostsFile: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if !tt.noHostsFile {
+				if err := os.WriteFile(filepath.Join(dir, "hosts.yml"), []byte(hosts), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			t.Setenv("GH_CONFIG_DIR", dir)
+			t.Setenv("GH_TOKEN", "")
+			t.Setenv("GITHUB_TOKEN", "")
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			got, err := githubToken(tt.host)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got token %q, want an error", got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("githubToken(%q) = %q, %v, want %q", tt.host, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGraphqlURLFor(t *testing.T) {
+	tests := []struct{ rest, want string }{
+		{"https://api.github.com", "https://api.github.com/graphql"},
+		{"https://ghe.example.com/api/v3", "https://ghe.example.com/api/graphql"},
+		{"http://127.0.0.1:8080", "http://127.0.0.1:8080/graphql"},
+	}
+	for _, tt := range tests {
+		if got := graphqlURLFor(tt.rest); got != tt.want {
+			t.Errorf("graphqlURLFor(%q) = %q, want %q", tt.rest, got, tt.want)
+		}
+	}
+}
+
+func TestNewAPIClientEnterprise(t *testing.T) {
+	dir := t.TempDir()
+	hosts := "ghe.example.com:\n    oauth_token: gho_enterprise\n"
+	if err := os.WriteFile(filepath.Join(dir, "hosts.yml"), []byte(hosts), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GH_CONFIG_DIR", dir)
+	t.Setenv("GH_TOKEN", "")
+	t.Setenv("GITHUB_TOKEN", "")
+	c, err := newAPIClient("https://ghe.example.com/api/v3/", "acme/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.baseURL != "https://ghe.example.com/api/v3" || c.graphqlURL != "https://ghe.example.com/api/graphql" || c.token != "gho_enterprise" {
+		t.Errorf("got base %q, GraphQL %q, token %q", c.baseURL, c.graphqlURL, c.token)
+	}
+	if repo, _ := c.Repo(); repo != "acme/app" {
+		t.Errorf("repo = %q, want acme/app", repo)
+	}
+}
+
+func TestConfigCurrentUserOutsideCheckout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/user" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		fmt.Fprint(w, `{"login": "alice"}`)
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("GH_TOKEN", "secret")
+	// No git remote to find a repository from.
+	t.Chdir(t.TempDir())
+
+	login, err := config{Backend: "api", APIURL: srv.URL}.currentUser()
+	if err != nil || login != "alice" {
+		t.Errorf("currentUser() = %q, %v, want alice", login, err)
+	}
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ---------- In-memory GitHub (tests) ----------
+
+// fakeGitHub is an in-memory repository implementing GitHub, so the
+// scheduling pipeline can be exercised offline. It records every write and
+// lets a test inject failures per method.
+type fakeGitHub struct {
+	mu sync.Mutex
+
+	user string
+	repo string
+	prs  map[int]*fakePR
+
+	// mergeOnAutoMerge makes EnableAutoMerge merge the PR right away, as
+	// GitHub does when all requirements already pass.
+	mergeOnAutoMerge bool
+	// errs holds errors returned (once) by the next call of a method, keyed
+	// by method name, e.g. "EnableAutoMerge".
+	errs map[string]error
+	// calls logs every call, e.g. "Comment #12".
+	calls []string
+}
+
+// fakePR is a pull request in a fakeGitHub.
+type fakePR struct {
+	pr
+	headSHA         string
+	checks          checksResult
+	reviewDecision  string
+	labels          []string
+	autoMerge       bool
+	autoMergeMethod mergeMethod
+	comments        []string
+}
+
+// current returns the PR as GitHub would report it now.
+func (p *fakePR) current(repo string) pr {
+	current := p.pr
+	current.Repo = repo
+	current.HeadSHA = p.headSHA
+	current.Labels = p.labels
+	current.ReviewDecision = p.reviewDecision
+	return current
+}
+
+func newFakeGitHub(user, repo string, prs ...pr) *fakeGitHub {
+	f := &fakeGitHub{
+		user: user,
+		repo: repo,
+		prs:  make(map[int]*fakePR),
+		errs: make(map[string]error),
+	}
+	for _, p := range prs {
+		if p.State == "" {
+			p.State = "OPEN"
+		}
+		f.prs[p.Number] = &fakePR{
+			pr:             p,
+			headSHA:        fmt.Sprintf("sha-%d", p.Number),
+			checks:         checksResult{State: "SUCCESS"},
+			reviewDecision: p.ReviewDecision,
+			labels:         p.Labels,
+		}
+	}
+	return f
+}
+
+// failNext makes the next call of method return err.
+func (f *fakeGitHub) failNext(method string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.errs[method] = err
+}
+
+// setState changes a PR's state, e.g. to simulate GitHub merging it.
+func (f *fakeGitHub) setState(number int, state string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if p, ok := f.prs[number]; ok {
+		p.State = state
+	}
+}
+
+// setMergeState changes a PR's mergeStateStatus, e.g. to BEHIND.
+func (f *fakeGitHub) setMergeState(number int, state string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if p, ok := f.prs[number]; ok {
+		p.MergeState = state
+	}
+}
+
+// setHeadSHA moves a PR's branch to another commit, e.g. to simulate a push.
+func (f *fakeGitHub) setHeadSHA(number int, sha string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if p, ok := f.prs[number]; ok {
+		p.headSHA = sha
+	}
+}
+
+// setChecks changes what CheckStatus reports for a PR.
+func (f *fakeGitHub) setChecks(number int, checks checksResult) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if p, ok := f.prs[number]; ok {
+		p.checks = checks
+	}
+}
+
+// setReviewDecision changes what ReviewDecision reports for a PR.
+func (f *fakeGitHub) setReviewDecision(number int, decision string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if p, ok := f.prs[number]; ok {
+		p.reviewDecision = decision
+	}
+}
+
+// setLabels changes the labels of a PR.
+func (f *fakeGitHub) setLabels(number int, labels ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if p, ok := f.prs[number]; ok {
+		p.labels = labels
+	}
+}
+
+// comments returns the comments posted on a PR.
+func (f *fakeGitHub) comments(number int) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if p, ok := f.prs[number]; ok {
+		return append([]string(nil), p.comments...)
+	}
+	return nil
+}
+
+// record logs a call and returns the injected error for it, if any.
+func (f *fakeGitHub) record(method string, number int) error {
+	if number != 0 {
+		f.calls = append(f.calls, fmt.Sprintf("%s #%d", method, number))
+	} else {
+		f.calls = append(f.calls, method)
+	}
+	if err, ok := f.errs[method]; ok {
+		delete(f.errs, method)
+		return err
+	}
+	return nil
+}
+
+func (f *fakeGitHub) lookup(number int) (*fakePR, error) {
+	p, ok := f.prs[number]
+	if !ok {
+		return nil, fmt.Errorf("PR #%d not found in %s", number, f.repo)
+	}
+	return p, nil
+}
+
+func (f *fakeGitHub) CurrentUser() (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("CurrentUser", 0); err != nil {
+		return "", err
+	}
+	return f.user, nil
+}
+
+func (f *fakeGitHub) Repo() (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("Repo", 0); err != nil {
+		return "", err
+	}
+	return f.repo, nil
+}
+
+func (f *fakeGitHub) ListPRs() ([]pr, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("ListPRs", 0); err != nil {
+		return nil, err
+	}
+	var prs []pr
+	for _, p := range f.prs {
+		if p.State == "OPEN" {
+			prs = append(prs, p.current(f.repo))
+		}
+	}
+	sort.Slice(prs, func(i, j int) bool { return prs[i].Number > prs[j].Number })
+	return prs, nil
+}
+
+func (f *fakeGitHub) GetPR(number int) (pr, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("GetPR", number); err != nil {
+		return pr{}, err
+	}
+	p, err := f.lookup(number)
+	if err != nil {
+		return pr{}, err
+	}
+	return p.current(f.repo), nil
+}
+
+func (f *fakeGitHub) PRState(number int) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("PRState", number); err != nil {
+		return "", err
+	}
+	p, err := f.lookup(number)
+	if err != nil {
+		return "", err
+	}
+	return p.State, nil
+}
+
+func (f *fakeGitHub) HeadSHA(number int) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("HeadSHA", number); err != nil {
+		return "", err
+	}
+	p, err := f.lookup(number)
+	if err != nil {
+		return "", err
+	}
+	return p.headSHA, nil
+}
+
+func (f *fakeGitHub) Comment(number int, body string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("Comment", number); err != nil {
+		return err
+	}
+	p, err := f.lookup(number)
+	if err != nil {
+		return err
+	}
+	p.comments = append(p.comments, body)
+	return nil
+}
+
+func (f *fakeGitHub) EnableAutoMerge(number int, method mergeMethod, headSHA string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("EnableAutoMerge", number); err != nil {
+		return err
+	}
+	p, err := f.lookup(number)
+	if err != nil {
+		return err
+	}
+	if p.State != "OPEN" {
+		return fmt.Errorf("PR #%d is %s", number, p.State)
+	}
+	if headSHA != "" && headSHA != p.headSHA {
+		return fmt.Errorf("PR #%d: head branch was modified (%s, expected %s)", number, p.headSHA, headSHA)
+	}
+	p.autoMerge = true
+	p.autoMergeMethod = method
+	if f.mergeOnAutoMerge {
+		p.State = "MERGED"
+	}
+	return nil
+}
+
+func (f *fakeGitHub) DisableAutoMerge(number int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("DisableAutoMerge", number); err != nil {
+		return err
+	}
+	p, err := f.lookup(number)
+	if err != nil {
+		return err
+	}
+	p.autoMerge = false
+	return nil
+}
+
+func (f *fakeGitHub) SetBase(number int, base string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("SetBase", number); err != nil {
+		return err
+	}
+	p, err := f.lookup(number)
+	if err != nil {
+		return err
+	}
+	p.BaseRef = base
+	return nil
+}
+
+func (f *fakeGitHub) UpdateBranch(number int, rebase bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("UpdateBranch", number); err != nil {
+		return err
+	}
+	p, err := f.lookup(number)
+	if err != nil {
+		return err
+	}
+	if p.MergeState != "BEHIND" {
+		return fmt.Errorf("PR #%d is not behind its base", number)
+	}
+	// A new head commit whose checks have yet to run.
+	p.MergeState = "BLOCKED"
+	p.headSHA += "-updated"
+	p.checks = checksResult{State: "PENDING", Pending: []string{"ci"}}
+	return nil
+}
+
+func (f *fakeGitHub) CheckStatus(number int) (checksResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("CheckStatus", number); err != nil {
+		return checksResult{}, err
+	}
+	p, err := f.lookup(number)
+	if err != nil {
+		return checksResult{}, err
+	}
+	return p.checks, nil
+}
+
+func (f *fakeGitHub) ReviewDecision(number int) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("ReviewDecision", number); err != nil {
+		return "", err
+	}
+	p, err := f.lookup(number)
+	if err != nil {
+		return "", err
+	}
+	return p.reviewDecision, nil
+}
+
+func (f *fakeGitHub) PRDetails(number int) (prDetails, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("PRDetails", number); err != nil {
+		return prDetails{}, err
+	}
+	p, err := f.lookup(number)
+	if err != nil {
+		return prDetails{}, err
+	}
+	d := prDetails{PR: p.current(f.repo), Mergeable: "MERGEABLE"}
+	if p.MergeState == "DIRTY" {
+		d.Mergeable = "CONFLICTING"
+	}
+	for _, name := range p.checks.Failing {
+		d.Checks = append(d.Checks, checkRun{Name: name, Result: "FAILURE"})
+	}
+	for _, name := range p.checks.Pending {
+		d.Checks = append(d.Checks, checkRun{Name: name, Result: "PENDING"})
+	}
+	return d, nil
+}
@@ -2,34 +2,86 @@
 //
 // Requirements:
 //   - gh (GitHub CLI) installed and authenticated
-//   - notify-send available (Linux desktop notifications)
+//   - notify-send available for desktop notifications (the default notifier)
 //   - Go modules enabled
 //
 // Usage:
 //
-//	go run main.go
+//	pr-scheduler                               interactive TUI (starts the daemon if needed)
+//	pr-scheduler --repo my-org/api --repo my-org/web
+//	                                           list the PRs of several repositories
+//	pr-scheduler --dry-run                     schedule dry runs: reads hit GitHub,
+//	                                           comments and auto-merge are only logged
+//	pr-scheduler daemon                        run the scheduler in the foreground, no TUI
+//	pr-scheduler schedule 123 --at "2026-10-17 09:00"
+//	pr-scheduler list [--active]               list scheduled merges
+//	pr-scheduler cancel 123                    cancel the scheduled merge of PR #123
+//	pr-scheduler status [123] [--json]         show schedule details
+//	pr-scheduler log [123] [--since 2d]        show the audit log
+//
+// The daemon performs the scheduled merges: the pre-merge comment,
+// `gh pr merge --auto`, polling until the PR merged and, if it has not by the
+// deadline, disabling auto-merge
+// plus a failure comment. It keeps running after the TUI exits and stops
+// cleanly on SIGTERM.
 //
 // Keys:
 //   - Up/Down or j/k: move selection
 //   - Enter: schedule auto-merge for selected PR (opens time picker)
+//   - s: schedule the whole stack of the selected PR, merged bottom-up
+//   - d: show the details of the selected PR: checks, reviews, labels, diff
+//     stats, mergeability and its schedule
 //   - m: toggle "only my PRs"
+//   - f: filter the PRs, combining mine, label:<name>, base:<branch>, draft
+//     or ready, review:<approved|changes|required|none>, requested (a
+//     review is requested from you) and assignee:<login|me>
 //   - r: refresh PR list
-//   - q: quit (will warn if there are active scheduled merges)
+//   - Tab: focus the scheduled merges panel
+//   - q: quit (scheduled merges keep running in the daemon)
+//
+// Scheduled merges are saved under $XDG_STATE_HOME/pr-scheduler (default
+// ~/.local/state/pr-scheduler) and resumed on the next start; every action
+// is also appended to audit.jsonl there.
 //
 // Time picker:
 //   - Navigate with Up/Down or j/k
 //   - Select from presets: Now, 5min, 15min, 30min, 1h, 2h, 4h, 8h, 12h, 24h
-//   - Choose "Custom time..." for manual entry (YYYY-MM-DD HH:MM format)
+//   - Choose "Custom time..." for manual entry: "2026-10-17 09:00", "+90m",
+//     "17:30", "tomorrow 9am", "fri 16:00" or "next monday 10:00", with a
+//     preview of the resolved time below the input
+//   - +/-: how long to keep verifying the merge before giving up (default
+//     from the config file)
 //   - Esc: cancel/go back
+//
+// Scheduled merges panel:
+//   - Up/Down or j/k: move selection
+//   - c: cancel (disables GitHub auto-merge if it was already enabled)
+//   - t: reschedule through the time picker
+//   - n: merge now
+//   - a: re-confirm a schedule held because commits were pushed after it
+//     was scheduled
+//   - Tab/Esc: back to the PR list
+//
+// PR details:
+//   - Enter: schedule auto-merge for the PR
+//   - r: reload the details
+//   - d/Esc: back to the PR list
+//
+// Merge method picker:
+//   - Choose merge, squash or rebase; the repo default from the config file
+//     is preselected
+//   - u: whether to update the branch (merge, rebase or off) when it is
+//     behind its base
+//   - Esc: back to the time picker
 package main
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/charmbracelet/bubbles/list"
@@ -41,23 +93,58 @@ import (
 // ---------- Data types ----------
 
 type pr struct {
+	Repo       string // "owner/name"
 	Number     int
 	Title      string
 	Author     string
 	State      string
+	Draft      bool
 	MergeState string
 	URL        string
+	BaseRef    string // branch the PR merges into
+	HeadRef    string // branch of the PR
+	HeadSHA    string // commit the branch pointed at when the PR was fetched
+	Labels     []string
+	// ReviewDecision is APPROVED, CHANGES_REQUESTED, REVIEW_REQUIRED, or ""
+	// when no review is required.
+	ReviewDecision string
+	Assignees      []string // logins
+	ReviewRequests []string // logins of users, names of teams
 }
 
+// ref identifies the PR across repositories, e.g. "my-org/api#12".
+func (p pr) ref() string { return fmt.Sprintf("%s#%d", p.Repo, p.Number) }
+
 type prItem struct {
-	p pr
+	p        pr
+	showRepo bool // set when PRs of several repositories are listed
+	depth    int  // position in a stack of PRs, 0 for its root
 }
 
-func (i prItem) Title() string { return fmt.Sprintf("#%d %s", i.p.Number, i.p.Title) }
+func (i prItem) Title() string {
+	indent := ""
+	if i.depth > 0 {
+		indent = strings.Repeat("  ", i.depth-1) + "└ "
+	}
+	if i.showRepo {
+		return fmt.Sprintf("%s%s #%d %s", indent, i.p.Repo, i.p.Number, i.p.Title)
+	}
+	return fmt.Sprintf("%s#%d %s", indent, i.p.Number, i.p.Title)
+}
 func (i prItem) Description() string {
-	return fmt.Sprintf("%s | %s | @%s", i.p.State, i.p.MergeState, i.p.Author)
+	parts := []string{i.p.State, i.p.MergeState, "@" + i.p.Author, "→ " + i.p.BaseRef}
+	if i.p.Draft {
+		parts = append(parts, "draft")
+	}
+	if i.p.ReviewDecision != "" {
+		parts = append(parts, strings.ToLower(strings.ReplaceAll(i.p.ReviewDecision, "_", " ")))
+	}
+	if len(i.p.Labels) > 0 {
+		parts = append(parts, "["+strings.Join(i.p.Labels, ", ")+"]")
+	}
+	return strings.Join(parts, " | ")
 }
-func (i prItem) FilterValue() string { return i.p.Title }
+func (i prItem) FilterValue() string { return i.p.Repo + " " + i.p.Title }
 
 // Time preset for the time picker
 type timePreset struct {
@@ -75,108 +162,116 @@ func (i timePresetItem) Title() string       { return i.preset.Label }
 func (i timePresetItem) Description() string { return i.preset.Description }
 func (i timePresetItem) FilterValue() string { return i.preset.Label }
 
-// For scheduling auto-merge of a PR.
-type scheduledMerge struct {
-	PR                    pr
-	When                  time.Time
-	PreMergeCommentPosted bool
-	MergeTriggered        bool
-	CheckScheduled        bool
-	CheckAt               time.Time
-	FailureHandled        bool
-	Done                  bool
-	LastMessage           string
+// Merge method choice for the method picker
+type mergeMethodItem struct {
+	method    mergeMethod
+	isDefault bool
+}
+
+var mergeMethodDescriptions = map[mergeMethod]string{
+	mergeMethodMerge:  "Create a merge commit",
+	mergeMethodSquash: "Squash all commits into one",
+	mergeMethodRebase: "Rebase the commits onto the base branch",
+}
+
+func (i mergeMethodItem) Title() string { return string(i.method) }
+func (i mergeMethodItem) Description() string {
+	if i.isDefault {
+		return mergeMethodDescriptions[i.method] + " (default for this repo)"
+	}
+	return mergeMethodDescriptions[i.method]
 }
+func (i mergeMethodItem) FilterValue() string { return string(i.method) }
 
 // ---------- Messages ----------
 
 type (
-	prListMsg      []pr
-	meMsg          string
-	errMsg         struct{ err error }
-	tickMsg        time.Time
-	mergeResultMsg struct {
-		prNumber int
-		err      error
-	}
-	checkMergedMsg struct {
-		prNumber int
-		merged   bool
-		err      error
-	}
-	commentResultMsg struct {
-		prNumber    int
-		isPreMerge  bool
-		err         error
-	}
-	disableAutoMergeResultMsg struct {
-		prNumber int
-		err      error
-	}
-	commitSHAMsg struct {
-		prNumber int
-		sha      string
-		err      error
+	prListMsg struct {
+		prs []pr
+		err error // set if some repositories could not be listed
+	}
+	meMsg     string
+	repoMsg   string
+	errMsg    struct{ err error }
+	tickMsg   time.Time
+	daemonMsg struct {
+		pid int // 0 if the daemon was already running
+		err error
+	}
+	// headsMsg carries the PRs about to be scheduled, with the commits
+	// their branches point at now.
+	headsMsg struct {
+		prs    []pr // a single PR, or a stack bottom-up
+		stack  bool
+		when   time.Time
+		method mergeMethod
+		err    error
 	}
 )
 
 // ---------- Commands (side effects) ----------
 
-func fetchMeCmd() tea.Cmd {
+func fetchMeCmd(gh GitHub) tea.Cmd {
 	return func() tea.Msg {
-		cmd := exec.Command("gh", "api", "user", "--jq", ".login")
-		out, err := cmd.CombinedOutput()
+		login, err := gh.CurrentUser()
 		if err != nil {
-			return errMsg{fmt.Errorf("failed to get current GitHub user: %w (%s)", err, string(out))}
+			return errMsg{fmt.Errorf("failed to get current GitHub user: %w", err)}
 		}
-		login := strings.TrimSpace(string(out))
 		return meMsg(login)
 	}
 }
 
-func fetchPRsCmd() tea.Cmd {
+// fetchHeadsCmd looks up the head commits of the PRs about to be scheduled,
+// see freshHeads.
+func fetchHeadsCmd(github func(repo string) GitHub, prs []pr, stack bool, when time.Time, method mergeMethod) tea.Cmd {
 	return func() tea.Msg {
-		cmd := exec.Command("gh", "pr", "list",
-			"--state", "open",
-			"--json", "number,title,author,state,mergeStateStatus,url",
-		)
-		out, err := cmd.CombinedOutput()
+		fresh, err := freshHeads(github, prs)
+		return headsMsg{prs: fresh, stack: stack, when: when, method: method, err: err}
+	}
+}
+
+func fetchRepoCmd(gh GitHub) tea.Cmd {
+	return func() tea.Msg {
+		repo, err := gh.Repo()
 		if err != nil {
-			return errMsg{fmt.Errorf("gh pr list failed: %w (%s)", err, string(out))}
+			return errMsg{fmt.Errorf("failed to get current repository: %w", err)}
 		}
+		return repoMsg(repo)
+	}
+}
 
-		var raw []struct {
-			Number int    `json:"number"`
-			Title  string `json:"title"`
-			State  string `json:"state"`
-			URL    string `json:"url"`
-			Author struct {
-				Login string `json:"login"`
-			} `json:"author"`
-			MergeStateStatus string `json:"mergeStateStatus"`
+// fetchPRsCmd lists the open PRs of all repositories in parallel, keeping the
+// PRs of the repositories that answered if others fail.
+func fetchPRsCmd(cfg config, repos []string) tea.Cmd {
+	return func() tea.Msg {
+		results := make([][]pr, len(repos))
+		errs := make([]error, len(repos))
+		var wg sync.WaitGroup
+		for i, repo := range repos {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				results[i], errs[i] = cfg.newGitHub(repo).ListPRs()
+			}()
 		}
+		wg.Wait()
 
-		if err := json.Unmarshal(out, &raw); err != nil {
-			return errMsg{fmt.Errorf("failed to parse gh pr list output: %w", err)}
+		var prs []pr
+		for _, r := range results {
+			prs = append(prs, r...)
 		}
+		return prListMsg{prs: prs, err: errors.Join(errs...)}
+	}
+}
 
-		prs := make([]pr, 0, len(raw))
-		for _, r := range raw {
-			ms := r.MergeStateStatus
-			if ms == "" {
-				ms = "unknown"
-			}
-			prs = append(prs, pr{
-				Number:     r.Number,
-				Title:      r.Title,
-				Author:     r.Author.Login,
-				State:      r.State,
-				MergeState: ms,
-				URL:        r.URL,
-			})
+// ensureDaemonCmd starts the background daemon unless one is already running.
+func ensureDaemonCmd() tea.Cmd {
+	return func() tea.Msg {
+		if daemonRunning() {
+			return daemonMsg{}
 		}
-
-		return prListMsg(prs)
+		pid, err := startDaemon()
+		return daemonMsg{pid: pid, err: err}
 	}
 }
 
@@ -186,76 +281,40 @@ func tickCmd() tea.Cmd {
 	})
 }
 
-func mergePRCmd(prNumber int) tea.Cmd {
-	return func() tea.Msg {
-		// Auto-merge using regular merge; change to --squash/--rebase if you prefer.
-		cmd := exec.Command("gh", "pr", "merge", "--auto", "--merge", strconv.Itoa(prNumber))
-		out, err := cmd.CombinedOutput()
-		if err != nil {
-			return mergeResultMsg{prNumber: prNumber, err: fmt.Errorf("gh pr merge failed: %w (%s)", err, string(out))}
-		}
-		return mergeResultMsg{prNumber: prNumber, err: nil}
-	}
+// verifyTimeouts are the steps +/- go through in the time picker.
+var verifyTimeouts = []time.Duration{
+	15 * time.Minute, 30 * time.Minute, time.Hour, 2 * time.Hour,
+	4 * time.Hour, 8 * time.Hour, 24 * time.Hour,
 }
 
-func commentPRCmd(prNumber int, body string, isPreMerge bool) tea.Cmd {
-	return func() tea.Msg {
-		cmd := exec.Command("gh", "pr", "comment", strconv.Itoa(prNumber), "--body", body)
-		out, err := cmd.CombinedOutput()
-		if err != nil {
-			return commentResultMsg{prNumber: prNumber, isPreMerge: isPreMerge, err: fmt.Errorf("gh pr comment failed: %w (%s)", err, string(out))}
+// stepVerifyTimeout returns the next longer (or shorter) verify timeout.
+func stepVerifyTimeout(d time.Duration, longer bool) time.Duration {
+	if longer {
+		for _, t := range verifyTimeouts {
+			if t > d {
+				return t
+			}
 		}
-		return commentResultMsg{prNumber: prNumber, isPreMerge: isPreMerge, err: nil}
+		return d
 	}
-}
-
-func disableAutoMergeCmd(prNumber int) tea.Cmd {
-	return func() tea.Msg {
-		cmd := exec.Command("gh", "pr", "merge", "--disable-auto", strconv.Itoa(prNumber))
-		out, err := cmd.CombinedOutput()
-		if err != nil {
-			return disableAutoMergeResultMsg{prNumber: prNumber, err: fmt.Errorf("gh pr merge --disable-auto failed: %w (%s)", err, string(out))}
+	for i := len(verifyTimeouts) - 1; i >= 0; i-- {
+		if verifyTimeouts[i] < d {
+			return verifyTimeouts[i]
 		}
-		return disableAutoMergeResultMsg{prNumber: prNumber, err: nil}
 	}
+	return d
 }
 
-func getCommitSHACmd(prNumber int) tea.Cmd {
-	return func() tea.Msg {
-		cmd := exec.Command("gh", "pr", "view", strconv.Itoa(prNumber), "--json", "headRefOid", "--jq", ".headRefOid")
-		out, err := cmd.CombinedOutput()
-		if err != nil {
-			return commitSHAMsg{prNumber: prNumber, sha: "", err: fmt.Errorf("gh pr view failed: %w (%s)", err, string(out))}
-		}
-		return commitSHAMsg{prNumber: prNumber, sha: strings.TrimSpace(string(out)), err: nil}
+// formatVerifyTimeout renders d without trailing zero units, e.g. "1h30m".
+func formatVerifyTimeout(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
 	}
-}
-
-func checkMergedCmd(prNumber int) tea.Cmd {
-	return func() tea.Msg {
-		// Ask gh if the PR is merged.
-		cmd := exec.Command("gh", "pr", "view", strconv.Itoa(prNumber),
-			"--json", "state",
-			"--jq", ".state",
-		)
-		out, err := cmd.CombinedOutput()
-		if err != nil {
-			return checkMergedMsg{
-				prNumber: prNumber,
-				merged:   false,
-				err:      fmt.Errorf("gh pr view failed: %w (%s)", err, string(out)),
-			}
-		}
-
-		mergedStr := strings.TrimSpace(string(out))
-		merged := mergedStr == "MERGED"
-
-		return checkMergedMsg{
-			prNumber: prNumber,
-			merged:   merged,
-			err:      nil,
-		}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
 	}
+	return s
 }
 
 // ---------- Model ----------
@@ -266,22 +325,43 @@ const (
 	modeListing mode = iota
 	modeTimePicker
 	modeScheduling
+	modeMethodPicker
+	modeSchedules // the scheduled merges panel has focus
+	modeDetail    // the detail pane of detailFor
+	modeFilter    // editing the PR filters
 )
 
 type model struct {
 	width, height int
 
+	github       GitHub // for the current user and the working directory's repo
 	list         list.Model
 	timePicker   list.Model
+	methodPicker list.Model
 	prs          []pr
-	onlyMine     bool
+	filter       prFilter
+	filterInput  textinput.Model
 	me           string
+	repos        []string // "owner/name" repositories whose PRs are listed
+	cfg          config
+	freeze       *freezePolicy
 	status       string
 	lastErr      error
+	loadErr      error // the last state file error, cleared from lastErr once it loads again
 	mode         mode
 	input        textinput.Model
 	schedFor     *pr
+	detailFor    pr
+	detail       *prDetails // nil while loading
+	dryRun       bool       // new schedules are dry runs, see dryRunGitHub
+	schedStack   []pr       // set when scheduling a whole stack, bottom-up
+	schedWhen    time.Time
+	schedVerify  time.Duration // how long the new schedule verifies its merge
+	schedUpdate  string        // how the new schedule updates a branch that is behind
+	rescheduling bool          // the time picker moves schedFor's schedule
 	scheduled    []scheduledMerge
+	scheduledAt  time.Time // modification time of the state file scheduled was read from
+	schedCursor  int
 	now          time.Time
 	quitWarned   bool
 }
@@ -312,12 +392,17 @@ func getTimePresets() []list.Item {
 	return items
 }
 
-func initialModel() model {
+func initialModel(repos []string, dryRun bool) model {
 	ti := textinput.New()
-	ti.Placeholder = "YYYY-MM-DD HH:MM or 'now'"
-	ti.CharLimit = 32
+	ti.Placeholder = "+90m, 17:30, tomorrow 9am, fri 16:00, YYYY-MM-DD HH:MM"
+	ti.CharLimit = 64
 	ti.Prompt = "Schedule at> "
 
+	fi := textinput.New()
+	fi.Placeholder = "mine label:bug base:main ready review:approved requested assignee:me"
+	fi.CharLimit = 256
+	fi.Prompt = "Filter> "
+
 	delegate := list.NewDefaultDelegate()
 	l := list.New([]list.Item{}, delegate, 0, 0)
 	l.Title = "Open pull requests"
@@ -330,59 +415,316 @@ func initialModel() model {
 	tp.SetShowHelp(false)
 	tp.SetFilteringEnabled(false)
 
+	// Merge method picker list
+	methodDelegate := list.NewDefaultDelegate()
+	mp := list.New([]list.Item{}, methodDelegate, 0, 0)
+	mp.Title = "How to merge?"
+	mp.SetShowHelp(false)
+	mp.SetFilteringEnabled(false)
+
+	cfg, err := loadConfig()
+	if len(repos) == 0 {
+		repos = cfg.Repositories
+	}
+	freeze, freezeErr := cfg.freezePolicy()
+	if err == nil {
+		err = freezeErr
+	}
+
+	scheduled, loadErr := loadSchedules()
+	if loadErr != nil {
+		scheduled = []scheduledMerge{}
+		err = loadErr
+	}
+
 	return model{
-		list:       l,
-		timePicker: tp,
-		status:     "Loading...",
-		mode:       modeListing,
-		input:      ti,
-		scheduled:  []scheduledMerge{},
-		now:        time.Now(),
+		github:       cfg.newGitHub(""),
+		list:         l,
+		timePicker:   tp,
+		methodPicker: mp,
+		cfg:          cfg,
+		freeze:       freeze,
+		repos:        repos,
+		dryRun:       dryRun,
+		status:       "Loading...",
+		lastErr:      err,
+		mode:         modeListing,
+		input:        ti,
+		filterInput:  fi,
+		scheduled:    scheduled,
+		loadErr:      loadErr,
+		now:          time.Now(),
 	}
 }
 
 func (m model) Init() tea.Cmd {
 	return tea.Batch(
-		fetchMeCmd(),
-		fetchPRsCmd(),
+		ensureDaemonCmd(),
+		fetchMeCmd(m.github),
+		m.refreshCmd(),
 		tickCmd(),
 	)
 }
 
+// refreshCmd reloads the PR list. Without configured repositories, the
+// repository of the working directory is looked up first.
+func (m model) refreshCmd() tea.Cmd {
+	if len(m.repos) == 0 {
+		return fetchRepoCmd(m.github)
+	}
+	return fetchPRsCmd(m.cfg, m.repos)
+}
+
 // ---------- Helpers ----------
 
 func (m *model) applyFilter() {
 	var filtered []pr
-	if m.onlyMine && m.me != "" {
-		for _, p := range m.prs {
-			if p.Author == m.me {
-				filtered = append(filtered, p)
-			}
+	for _, p := range m.prs {
+		if m.filter.matches(p, m.me) {
+			filtered = append(filtered, p)
 		}
-	} else {
-		filtered = m.prs
 	}
 
-	items := make([]list.Item, 0, len(filtered))
-	for _, p := range filtered {
-		items = append(items, prItem{p: p})
+	// Stacked PRs are listed as a tree under the bottom of their stack.
+	ordered, depths := stackTree(filtered)
+	items := make([]list.Item, 0, len(ordered))
+	for i, p := range ordered {
+		items = append(items, prItem{p: p, showRepo: len(m.repos) > 1, depth: depths[i]})
 	}
 	m.list.SetItems(items)
-	m.status = fmt.Sprintf("%d PRs (onlyMine=%v)", len(filtered), m.onlyMine)
+	m.status = fmt.Sprintf("%d of %d PRs", len(filtered), len(m.prs))
+}
+
+func (m *model) findScheduledIndex(p pr) int {
+	return findScheduled(m.scheduled, p.Repo, p.Number)
+}
+
+// pickTime opens the time picker to schedule p, unless it already has an
+// active schedule.
+func (m *model) pickTime(p pr) {
+	// Avoid scheduling duplicates for same PR if one is already active.
+	if m.findScheduledIndex(p) >= 0 {
+		m.status = fmt.Sprintf("PR %s already has a scheduled merge (tab to manage it)", p.ref())
+		return
+	}
+	m.schedStack = nil
+	m.schedFor = &p
+	m.schedVerify = m.cfg.verifyTimeout()
+	m.mode = modeTimePicker
+	m.status = fmt.Sprintf("Select merge time for PR %s", p.ref())
+}
+
+// openDetail shows the detail pane of p and loads what it shows.
+func (m *model) openDetail(p pr) tea.Cmd {
+	m.detailFor = p
+	m.detail = nil
+	m.mode = modeDetail
+	m.status = fmt.Sprintf("Loading details of PR %s...", p.ref())
+	return fetchDetailsCmd(m.cfg.newGitHub(p.Repo), p)
+}
+
+// openMethodPicker asks how to merge, preselecting the repo default.
+func (m *model) openMethodPicker() {
+	def := m.cfg.mergeMethodFor(m.schedFor.Repo)
+	items := make([]list.Item, len(mergeMethods))
+	selected := 0
+	for i, mm := range mergeMethods {
+		items[i] = mergeMethodItem{method: mm, isDefault: mm == def}
+		if mm == def {
+			selected = i
+		}
+	}
+	m.methodPicker.SetItems(items)
+	m.methodPicker.Select(selected)
+	m.schedUpdate = m.cfg.updateBranchFor(m.schedFor.Repo)
+	m.mode = modeMethodPicker
+	m.status = fmt.Sprintf("Select merge method for PR %s", m.schedFor.ref())
+}
+
+// schedule hands a new scheduled merge over to the daemon via the state file,
+// pinned to p.HeadSHA as looked up by fetchHeadsCmd.
+func (m *model) schedule(p pr, when time.Time, method mergeMethod) {
+	when, message, err := m.freeze.check(when)
+	if err != nil {
+		m.status = "Cannot schedule: " + err.Error()
+		return
+	}
+	s := scheduledMerge{
+		PR:            p,
+		When:          when,
+		MergeMethod:   method,
+		Gate:          m.cfg.gateFor(p.Repo),
+		UpdateBranch:  m.schedUpdate,
+		VerifyTimeout: m.schedVerify,
+		DryRun:        m.dryRun,
+		HeadSHA:       p.HeadSHA,
+		CheckAt:       time.Time{}, // set after auto-merge triggers
+		LastMessage:   message,
+	}
+	if err := addSchedule(s); err != nil {
+		m.status = "Failed to schedule: " + err.Error()
+		return
+	}
+	m.reloadSchedules()
+	m.status = fmt.Sprintf("Scheduled auto-merge (%s) for PR %s at %s", method, p.ref(), when.Format("2006-01-02 15:04"))
+	if message != "" {
+		m.status += " - " + message
+	}
 }
 
-func (m *model) findScheduledIndex(prNumber int) int {
-	for i, s := range m.scheduled {
-		if s.PR.Number == prNumber && !s.Done {
-			return i
+// scheduleStack schedules every PR of stack, each one after the one it is
+// based on.
+func (m *model) scheduleStack(stack []pr, when time.Time, method mergeMethod) {
+	when, message, err := m.freeze.check(when)
+	if err != nil {
+		m.status = "Cannot schedule: " + err.Error()
+		return
+	}
+	scheduled := stackSchedules(stack, when, method)
+	for i := range scheduled {
+		scheduled[i].Gate = m.cfg.gateFor(stack[i].Repo)
+		scheduled[i].UpdateBranch = m.schedUpdate
+		scheduled[i].VerifyTimeout = m.schedVerify
+		scheduled[i].DryRun = m.dryRun
+		scheduled[i].LastMessage = message
+	}
+	if err := addSchedules(scheduled); err != nil {
+		m.status = "Failed to schedule: " + err.Error()
+		return
+	}
+	m.reloadSchedules()
+	m.status = fmt.Sprintf("Scheduled stack of %d PRs from %s at %s", len(stack), stack[0].ref(), when.Format("2006-01-02 15:04"))
+	if message != "" {
+		m.status += " - " + message
+	}
+}
+
+// reloadSchedules picks up the state file, keeping the panel cursor in range.
+func (m *model) reloadSchedules() {
+	modTime, err := schedulesModTime()
+	if err == nil {
+		m.readSchedules(modTime)
+		return
+	}
+	m.loadErr, m.lastErr = err, err
+}
+
+// reloadChangedSchedules reloads the state file only when it was written since
+// it was last read.
+func (m *model) reloadChangedSchedules() {
+	modTime, err := schedulesModTime()
+	if err != nil {
+		m.loadErr, m.lastErr = err, err
+		return
+	}
+	if modTime.Equal(m.scheduledAt) && m.loadErr == nil {
+		return
+	}
+	m.readSchedules(modTime)
+}
+
+// readSchedules reads the state file last written at modTime.
+func (m *model) readSchedules(modTime time.Time) {
+	scheduled, err := loadSchedules()
+	if err != nil {
+		m.loadErr, m.lastErr = err, err
+		return
+	}
+	if m.lastErr == m.loadErr {
+		m.lastErr = nil
+	}
+	m.loadErr = nil
+	m.scheduled = scheduled
+	m.scheduledAt = modTime
+	if m.schedCursor >= len(m.scheduled) {
+		m.schedCursor = len(m.scheduled) - 1
+	}
+	if m.schedCursor < 0 {
+		m.schedCursor = 0
+	}
+	if len(m.scheduled) == 0 && m.mode == modeSchedules {
+		m.mode = modeListing
+	}
+}
+
+// selectedSchedule returns the active schedule under the panel cursor.
+func (m *model) selectedSchedule() (scheduledMerge, bool) {
+	if m.schedCursor >= len(m.scheduled) {
+		return scheduledMerge{}, false
+	}
+	s := m.scheduled[m.schedCursor]
+	if s.done() {
+		m.status = fmt.Sprintf("Scheduled merge for PR %s has already finished", s.PR.ref())
+		return scheduledMerge{}, false
+	}
+	return s, true
+}
+
+// cancelSelected cancels the schedule under the cursor. If auto-merge was
+// already enabled on GitHub, it is switched off again.
+func (m *model) cancelSelected() tea.Cmd {
+	s, ok := m.selectedSchedule()
+	if !ok {
+		return nil
+	}
+	cancelled, found, err := cancelSchedule(s.PR.Repo, s.PR.Number, m.now)
+	if err != nil {
+		m.status = "Failed to cancel: " + err.Error()
+		return nil
+	}
+	m.reloadSchedules()
+	if !found {
+		m.status = fmt.Sprintf("Scheduled merge for PR %s has already finished", s.PR.ref())
+		return nil
+	}
+	if cancelled.autoMergeRequested() {
+		m.status = fmt.Sprintf("Cancelled scheduled merge for PR %s, disabling auto-merge...", s.PR.ref())
+		gh := m.cfg.newGitHub(s.PR.Repo)
+		if cancelled.DryRun {
+			gh = dryRunGitHub{GitHub: gh, repo: s.PR.Repo}
+		}
+		return disableAutoMergeCmd(gh, cancelled.PR)
+	}
+	m.status = fmt.Sprintf("Cancelled scheduled merge for PR %s", s.PR.ref())
+	return nil
+}
+
+// reschedule moves schedFor's schedule to a new time and returns to the panel.
+func (m *model) reschedule(when time.Time) {
+	p := *m.schedFor
+	m.schedFor = nil
+	m.rescheduling = false
+	m.mode = modeSchedules
+	when, message, err := m.freeze.check(when)
+	if err != nil {
+		m.status = "Cannot reschedule: " + err.Error()
+		return
+	}
+	if err := rescheduleSchedule(p.Repo, p.Number, when, message); err != nil {
+		m.status = "Failed to reschedule: " + err.Error()
+		return
+	}
+	m.reloadSchedules()
+	m.status = fmt.Sprintf("Rescheduled PR %s to %s", p.ref(), when.Format("2006-01-02 15:04"))
+	if message != "" {
+		m.status += " - " + message
+	}
+}
+
+// activeDryRuns counts the dry-run schedules that have not finished.
+func (m *model) activeDryRuns() int {
+	n := 0
+	for _, s := range m.scheduled {
+		if s.DryRun && !s.done() {
+			n++
 		}
 	}
-	return -1
+	return n
 }
 
 func (m *model) hasActiveSchedules() bool {
 	for _, s := range m.scheduled {
-		if !s.Done {
+		if !s.done() {
 			return true
 		}
 	}
@@ -399,17 +741,27 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.height = msg.Height
 		m.list.SetSize(m.width, m.height-5)
 		m.timePicker.SetSize(m.width, m.height-5)
+		m.methodPicker.SetSize(m.width, m.height-5)
 		return m, nil
 
+	case repoMsg:
+		// No repositories configured: list the working directory's one.
+		m.repos = []string{string(msg)}
+		return m, m.refreshCmd()
+
 	case meMsg:
 		m.me = string(msg)
+		audit.setUser(m.me)
 		m.status = "Loaded GitHub user: " + m.me
 		m.applyFilter()
 		return m, nil
 
 	case prListMsg:
-		m.prs = msg
+		m.prs = msg.prs
 		m.applyFilter()
+		if msg.err != nil {
+			m.lastErr = msg.err
+		}
 		return m, nil
 
 	case errMsg:
@@ -419,136 +771,68 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	case tickMsg:
 		m.now = time.Time(msg)
-		// For each scheduled merge, decide whether to trigger actions.
-		var cmds []tea.Cmd
-		for i := range m.scheduled {
-			s := &m.scheduled[i]
-			if s.Done {
-				continue
-			}
-			// First, post a comment before triggering auto-merge.
-			if !s.PreMergeCommentPosted && !s.When.IsZero() && m.now.After(s.When) {
-				s.PreMergeCommentPosted = true
-				s.LastMessage = fmt.Sprintf("Posting pre-merge comment for PR #%d", s.PR.Number)
-				comment := fmt.Sprintf("Setting PR to auto-merge. Scheduled merge time: %s", s.When.Format("2006-01-02 15:04"))
-				cmds = append(cmds, commentPRCmd(s.PR.Number, comment, true))
-			}
-			// After we have a CheckAt time and it's passed, schedule a check.
-			if s.MergeTriggered && !s.CheckScheduled && !s.CheckAt.IsZero() && m.now.After(s.CheckAt) {
-				s.CheckScheduled = true
-				s.LastMessage = fmt.Sprintf("Checking merge status for PR #%d", s.PR.Number)
-				cmds = append(cmds, checkMergedCmd(s.PR.Number))
-			}
+		// The daemon drives the schedules; just pick up its progress.
+		m.reloadChangedSchedules()
+		return m, tickCmd()
+
+	case prDetailsMsg:
+		// Ignore details of a PR the pane no longer shows.
+		if m.mode != modeDetail || msg.p.ref() != m.detailFor.ref() {
+			return m, nil
 		}
-		// Keep ticking.
-		cmds = append(cmds, tickCmd())
-		return m, tea.Batch(cmds...)
-
-	case mergeResultMsg:
-		idx := m.findScheduledIndex(msg.prNumber)
-		if idx >= 0 {
-			if msg.err != nil {
-				m.scheduled[idx].Done = true
-				m.scheduled[idx].LastMessage = "Auto-merge failed: " + msg.err.Error()
-				m.status = m.scheduled[idx].LastMessage
-			} else {
-				// Auto-merge set; schedule the check 1 minute later.
-				m.scheduled[idx].CheckAt = m.now.Add(1 * time.Minute)
-				m.scheduled[idx].LastMessage = "Auto-merge set, will check in 1 minute"
-				m.status = fmt.Sprintf("PR #%d: auto-merge set; check at %s", msg.prNumber, m.scheduled[idx].CheckAt.Format(time.RFC3339))
-			}
+		if msg.err != nil {
+			m.lastErr = fmt.Errorf("failed to load PR %s: %w", msg.p.ref(), msg.err)
+			m.status = "Could not load the details, r to retry"
+			return m, nil
 		}
+		m.detail = &msg.details
+		m.status = "enter: schedule | r: reload | d/esc: back to PRs"
 		return m, nil
 
-	case checkMergedMsg:
-		idx := m.findScheduledIndex(msg.prNumber)
-		if idx >= 0 {
-			if msg.err != nil {
-				m.scheduled[idx].Done = true
-				m.scheduled[idx].LastMessage = "Check failed: " + msg.err.Error()
-				m.status = fmt.Sprintf("PR #%d: %s", msg.prNumber, m.scheduled[idx].LastMessage)
-			} else if msg.merged {
-				m.scheduled[idx].Done = true
-				m.scheduled[idx].LastMessage = "PR is merged"
-				m.status = fmt.Sprintf("PR #%d: %s", msg.prNumber, m.scheduled[idx].LastMessage)
-			} else {
-				// PR is not merged - get commit SHA to include in failure comment
-				m.scheduled[idx].LastMessage = "PR not merged, fetching commit SHA..."
-				m.status = fmt.Sprintf("PR #%d: %s", msg.prNumber, m.scheduled[idx].LastMessage)
-				return m, getCommitSHACmd(msg.prNumber)
-			}
+	case disableAutoMergeResultMsg:
+		ref := pr{Repo: msg.repo, Number: msg.prNumber}.ref()
+		if msg.err != nil {
+			m.lastErr = fmt.Errorf("failed to disable auto-merge for PR %s: %w", ref, msg.err)
+		} else {
+			m.status = "Auto-merge disabled for PR " + ref
 		}
 		return m, nil
 
-	case commitSHAMsg:
-		idx := m.findScheduledIndex(msg.prNumber)
-		if idx >= 0 {
-			s := &m.scheduled[idx]
-			sha := msg.sha
-			if msg.err != nil {
-				sha = "unknown"
-			}
-			// Disable auto-merge and post failure comment
-			s.FailureHandled = true
-			s.LastMessage = "Disabling auto-merge and posting failure comment..."
-			m.status = fmt.Sprintf("PR #%d: %s", msg.prNumber, s.LastMessage)
-
-			failureComment := fmt.Sprintf("Auto-merge did not complete successfully. Disabling auto-merge.\n\nCurrent commit: %s", sha)
-
-			// Send desktop notification
-			notifyTitle := "PR not merged"
-			notifyBody := fmt.Sprintf("PR #%d (%s) is still not merged after auto-merge.", msg.prNumber, s.PR.Title)
-			_ = exec.Command("notify-send", notifyTitle, notifyBody, "-u", "critical").Run()
-
-			return m, tea.Batch(
-				disableAutoMergeCmd(msg.prNumber),
-				commentPRCmd(msg.prNumber, failureComment, false),
-			)
-		}
-		return m, nil
-
-	case commentResultMsg:
-		idx := m.findScheduledIndex(msg.prNumber)
-		if idx >= 0 {
-			if msg.isPreMerge {
-				// Pre-merge comment posted, now trigger auto-merge
-				if msg.err != nil {
-					m.scheduled[idx].LastMessage = "Comment failed: " + msg.err.Error() + " (continuing with merge)"
-				} else {
-					m.scheduled[idx].LastMessage = "Pre-merge comment posted, triggering auto-merge..."
-				}
-				m.scheduled[idx].MergeTriggered = true
-				m.status = fmt.Sprintf("PR #%d: %s", msg.prNumber, m.scheduled[idx].LastMessage)
-				return m, mergePRCmd(msg.prNumber)
-			} else {
-				// Failure comment posted - mark as done
-				m.scheduled[idx].Done = true
-				if msg.err != nil {
-					m.scheduled[idx].LastMessage = "PR not merged (failure comment failed: " + msg.err.Error() + ")"
-				} else {
-					m.scheduled[idx].LastMessage = "PR not merged (auto-merge disabled, notification sent)"
-				}
-				m.status = fmt.Sprintf("PR #%d: %s", msg.prNumber, m.scheduled[idx].LastMessage)
-			}
+	case headsMsg:
+		if msg.err != nil {
+			m.lastErr = msg.err
+			m.status = "Cannot schedule without the commit to merge, try again"
+			return m, nil
+		}
+		if msg.stack {
+			m.scheduleStack(msg.prs, msg.when, msg.method)
+		} else {
+			m.schedule(msg.prs[0], msg.when, msg.method)
 		}
 		return m, nil
 
-	case disableAutoMergeResultMsg:
-		idx := m.findScheduledIndex(msg.prNumber)
-		if idx >= 0 {
-			if msg.err != nil {
-				// Log the error but don't fail - the comment is more important
-				m.scheduled[idx].LastMessage = "Failed to disable auto-merge: " + msg.err.Error()
-			}
-			// Don't mark as done here - wait for the comment result
+	case daemonMsg:
+		if msg.err != nil {
+			m.lastErr = msg.err
+			m.status = "Scheduler daemon is not running; scheduled merges will not fire"
+		} else if msg.pid != 0 {
+			m.status = fmt.Sprintf("Started scheduler daemon (pid %d)", msg.pid)
 		}
 		return m, nil
 
 	case tea.KeyMsg:
 		if m.mode == modeScheduling {
 			return m.updateSchedulingKey(msg)
+		} else if m.mode == modeMethodPicker {
+			return m.updateMethodPickerKey(msg)
 		} else if m.mode == modeTimePicker {
 			return m.updateTimePickerKey(msg)
+		} else if m.mode == modeSchedules {
+			return m.updateSchedulesKey(msg)
+		} else if m.mode == modeDetail {
+			return m.updateDetailKey(msg)
+		} else if m.mode == modeFilter {
+			return m.updateFilterKey(msg)
 		}
 		return m.updateListingKey(msg)
 
@@ -558,6 +842,14 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			var cmd tea.Cmd
 			m.input, cmd = m.input.Update(msg)
 			return m, cmd
+		} else if m.mode == modeFilter {
+			var cmd tea.Cmd
+			m.filterInput, cmd = m.filterInput.Update(msg)
+			return m, cmd
+		} else if m.mode == modeMethodPicker {
+			var cmd tea.Cmd
+			m.methodPicker, cmd = m.methodPicker.Update(msg)
+			return m, cmd
 		} else if m.mode == modeTimePicker {
 			var cmd tea.Cmd
 			m.timePicker, cmd = m.timePicker.Update(msg)
@@ -572,38 +864,79 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 func (m model) updateListingKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
 	case "q", "ctrl+c":
-		// Check if there are active scheduled merges
-		if m.hasActiveSchedules() && !m.quitWarned {
+		// Scheduled merges keep running in the daemon; only warn when it is gone.
+		if m.hasActiveSchedules() && !daemonRunning() && !m.quitWarned {
 			m.quitWarned = true
-			m.status = "Warning: Active scheduled merges! Press 'q' again to force quit."
+			m.status = "Warning: Active scheduled merges but no daemon running! Press 'q' again to quit anyway."
 			return m, nil
 		}
 		return m, tea.Quit
 
 	case "m":
 		m.quitWarned = false // Reset quit warning
-		m.onlyMine = !m.onlyMine
+		m.filter.onlyMine = !m.filter.onlyMine
 		m.applyFilter()
 		return m, nil
 
+	case "f":
+		m.quitWarned = false // Reset quit warning
+		m.filterInput.SetValue(m.filter.String())
+		m.filterInput.CursorEnd()
+		m.filterInput.Focus()
+		m.mode = modeFilter
+		m.status = "Filters combine; empty lists all PRs. enter: apply | esc: keep the current ones"
+		return m, nil
+
 	case "r":
 		m.quitWarned = false // Reset quit warning
 		m.status = "Refreshing PR list..."
-		return m, fetchPRsCmd()
+		return m, m.refreshCmd()
 
-	case "enter":
+	case "tab":
 		m.quitWarned = false // Reset quit warning
-		// Start time picker for selected PR.
+		if len(m.scheduled) == 0 {
+			m.status = "No scheduled merges"
+			return m, nil
+		}
+		m.mode = modeSchedules
+		m.status = "c: cancel | t: reschedule | n: merge now | a: re-confirm new commits | tab/esc: back to PRs"
+		return m, nil
+
+	case "s":
+		m.quitWarned = false // Reset quit warning
+		// Start time picker for the whole stack of the selected PR.
 		if item, ok := m.list.SelectedItem().(prItem); ok {
-			p := item.p
-			// Avoid scheduling duplicates for same PR if one is already active.
-			if m.findScheduledIndex(p.Number) >= 0 {
-				m.status = fmt.Sprintf("PR #%d already has a scheduled merge", p.Number)
+			stack := stackOf(m.prs, item.p)
+			if len(stack) < 2 {
+				m.status = fmt.Sprintf("PR %s is not part of a stack", item.p.ref())
 				return m, nil
 			}
-			m.schedFor = &p
+			for _, p := range stack {
+				if m.findScheduledIndex(p) >= 0 {
+					m.status = fmt.Sprintf("PR %s already has a scheduled merge", p.ref())
+					return m, nil
+				}
+			}
+			m.schedStack = stack
+			m.schedFor = &stack[0]
+			m.schedVerify = m.cfg.verifyTimeout()
 			m.mode = modeTimePicker
-			m.status = fmt.Sprintf("Select merge time for PR #%d", p.Number)
+			m.status = fmt.Sprintf("Select merge time for the stack of %d PRs from %s", len(stack), stack[0].ref())
+		}
+		return m, nil
+
+	case "d":
+		m.quitWarned = false // Reset quit warning
+		if item, ok := m.list.SelectedItem().(prItem); ok {
+			return m, m.openDetail(item.p)
+		}
+		return m, nil
+
+	case "enter":
+		m.quitWarned = false // Reset quit warning
+		// Start time picker for selected PR.
+		if item, ok := m.list.SelectedItem().(prItem); ok {
+			m.pickTime(item.p)
 		}
 		return m, nil
 	}
@@ -640,24 +973,34 @@ func (m model) updateTimePickerKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 				m.mode = modeListing
 				return m, nil
 			}
-
-			s := scheduledMerge{
-				PR:      *m.schedFor,
-				When:    when,
-				CheckAt: time.Time{}, // set after auto-merge triggers
+			if m.rescheduling {
+				m.reschedule(when)
+				return m, nil
 			}
-			m.scheduled = append(m.scheduled, s)
-			m.status = fmt.Sprintf("Scheduled auto-merge for PR #%d at %s", s.PR.Number, when.Format("2006-01-02 15:04"))
-			m.mode = modeListing
-			m.schedFor = nil
+
+			m.schedWhen = when
+			m.openMethodPicker()
 			return m, nil
 		}
 		return m, nil
 
+	case "+", "-":
+		if !m.rescheduling {
+			m.schedVerify = stepVerifyTimeout(m.schedVerify, msg.String() == "+")
+		}
+		return m, nil
+
 	case "esc", "q":
+		m.schedFor = nil
+		m.schedStack = nil
+		if m.rescheduling {
+			m.rescheduling = false
+			m.mode = modeSchedules
+			m.status = "Rescheduling cancelled"
+			return m, nil
+		}
 		m.mode = modeListing
 		m.status = "Scheduling cancelled"
-		m.schedFor = nil
 		return m, nil
 	}
 
@@ -666,23 +1009,191 @@ func (m model) updateTimePickerKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	return m, cmd
 }
 
-func (m model) updateSchedulingKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+func (m model) updateMethodPickerKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		if item, ok := m.methodPicker.SelectedItem().(mergeMethodItem); ok {
+			if m.schedFor == nil {
+				m.status = "No PR selected to schedule."
+				m.mode = modeListing
+				return m, nil
+			}
+			prs, stack := []pr{*m.schedFor}, m.schedStack != nil
+			if stack {
+				prs = m.schedStack
+			}
+			m.status = fmt.Sprintf("Looking up the head commit of PR %s...", m.schedFor.ref())
+			if stack {
+				m.status = fmt.Sprintf("Looking up the head commits of the stack of PR %s...", m.schedFor.ref())
+			}
+			m.mode = modeListing
+			m.schedFor = nil
+			m.schedStack = nil
+			return m, fetchHeadsCmd(m.cfg.newGitHub, prs, stack, m.schedWhen, item.method)
+		}
+		return m, nil
+
+	case "u":
+		// Cycle off -> merge -> rebase.
+		switch m.schedUpdate {
+		case "":
+			m.schedUpdate = "merge"
+		case "merge":
+			m.schedUpdate = "rebase"
+		default:
+			m.schedUpdate = ""
+		}
+		return m, nil
+
+	case "esc", "q":
+		m.mode = modeTimePicker
+		m.status = "Back to time selection"
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.methodPicker, cmd = m.methodPicker.Update(msg)
+	return m, cmd
+}
+
+func (m model) updateSchedulesKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		return m.updateListingKey(msg)
+
+	case "tab", "esc", "q":
+		m.mode = modeListing
+		m.status = ""
+		return m, nil
+
+	case "up", "k":
+		if m.schedCursor > 0 {
+			m.schedCursor--
+		}
+		return m, nil
+
+	case "down", "j":
+		if m.schedCursor < len(m.scheduled)-1 {
+			m.schedCursor++
+		}
+		return m, nil
+
+	case "c":
+		return m, m.cancelSelected()
+
+	case "t":
+		// Pick a new time through the regular time picker.
+		if s, ok := m.selectedSchedule(); ok {
+			if s.State != statePending {
+				m.status = fmt.Sprintf("PR %s is already being merged", s.PR.ref())
+				return m, nil
+			}
+			p := s.PR
+			m.schedFor = &p
+			m.rescheduling = true
+			m.mode = modeTimePicker
+			m.status = fmt.Sprintf("Select new merge time for PR %s", p.ref())
+		}
+		return m, nil
+
+	case "a":
+		// Accept the commits pushed since the merge was scheduled.
+		if s, ok := m.selectedSchedule(); ok {
+			if s.NewHeadSHA == "" {
+				m.status = fmt.Sprintf("PR %s does not need re-confirmation", s.PR.ref())
+				return m, nil
+			}
+			confirmed, err := confirmHead(s.PR.Repo, s.PR.Number, m.now)
+			if err != nil {
+				m.status = "Failed to re-confirm: " + err.Error()
+				return m, nil
+			}
+			m.reloadSchedules()
+			m.status = fmt.Sprintf("PR %s will be merged at %s", s.PR.ref(), shortSHA(confirmed.HeadSHA))
+		}
+		return m, nil
+
+	case "n":
+		if s, ok := m.selectedSchedule(); ok {
+			when, message, err := m.freeze.check(m.now)
+			if err != nil {
+				m.status = "Cannot merge now: " + err.Error()
+				return m, nil
+			}
+			if err := rescheduleSchedule(s.PR.Repo, s.PR.Number, when, message); err != nil {
+				m.status = "Failed to merge now: " + err.Error()
+				return m, nil
+			}
+			m.reloadSchedules()
+			if message != "" {
+				m.status = fmt.Sprintf("PR %s: %s", s.PR.ref(), message)
+			} else {
+				m.status = fmt.Sprintf("PR %s will be merged right away", s.PR.ref())
+			}
+		}
+		return m, nil
+	}
+	return m, nil
+}
+
+func (m model) updateDetailKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		return m.updateListingKey(msg)
+
+	case "d", "esc", "q":
+		m.mode = modeListing
+		m.detail = nil
+		m.status = ""
+		return m, nil
+
+	case "r":
+		return m, m.openDetail(m.detailFor)
+
+	case "enter":
+		p := m.detailFor
+		if m.detail != nil {
+			p = m.detail.PR // fresher, e.g. its head commit
+		}
+		m.pickTime(p)
+		return m, nil
+	}
+	return m, nil
+}
+
+func (m model) updateFilterKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.Type {
 	case tea.KeyEnter:
-		// Parse date/time and create schedule.
-		raw := strings.TrimSpace(m.input.Value())
-		var when time.Time
-		var err error
-
-		if raw == "" || strings.ToLower(raw) == "now" {
-			when = m.now
-		} else {
-			layout := "2006-01-02 15:04"
-			when, err = time.ParseInLocation(layout, raw, time.Local)
+		filter, err := parsePRFilter(m.filterInput.Value())
+		if err != nil {
+			m.status = "Invalid filter: " + err.Error()
+			return m, nil
 		}
+		m.filter = filter
+		m.filterInput.Blur()
+		m.mode = modeListing
+		m.applyFilter()
+		return m, nil
+
+	case tea.KeyEsc:
+		m.filterInput.Blur()
+		m.mode = modeListing
+		m.status = "Filters unchanged"
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.filterInput, cmd = m.filterInput.Update(msg)
+	return m, cmd
+}
 
+func (m model) updateSchedulingKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEnter:
+		// Parse date/time and create schedule.
+		when, err := parseScheduleTime(m.input.Value(), m.now)
 		if err != nil {
-			m.status = "Invalid time format. Use YYYY-MM-DD HH:MM or 'now'."
+			m.status = "Invalid time: " + err.Error()
 			return m, nil
 		}
 		if m.schedFor == nil {
@@ -692,16 +1203,13 @@ func (m model) updateSchedulingKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			return m, nil
 		}
 
-		s := scheduledMerge{
-			PR:      *m.schedFor,
-			When:    when,
-			CheckAt: time.Time{}, // set after auto-merge triggers
-		}
-		m.scheduled = append(m.scheduled, s)
-		m.status = fmt.Sprintf("Scheduled auto-merge for PR #%d at %s", s.PR.Number, when.Format("2006-01-02 15:04"))
-		m.mode = modeListing
 		m.input.Blur()
-		m.schedFor = nil
+		if m.rescheduling {
+			m.reschedule(when)
+			return m, nil
+		}
+		m.schedWhen = when
+		m.openMethodPicker()
 		return m, nil
 
 	case tea.KeyEsc:
@@ -722,15 +1230,34 @@ func (m model) View() string {
 	headerStyle := lipgloss.NewStyle().Bold(true)
 	statusStyle := lipgloss.NewStyle().Faint(true)
 	errStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+	dryRunStyle := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("0")).Background(lipgloss.Color("11"))
 
 	var b strings.Builder
 
 	// Header
 	b.WriteString(headerStyle.Render("GitHub PR Auto-Merge Scheduler"))
+	if m.dryRun {
+		b.WriteString(" ")
+		b.WriteString(dryRunStyle.Render(" DRY RUN: no comments, no auto-merge "))
+	} else if n := m.activeDryRuns(); n > 0 {
+		// Scheduled elsewhere, e.g. with `pr-scheduler schedule --dry-run`.
+		banner := " 1 DRY RUN SCHEDULED: only logged "
+		if n > 1 {
+			banner = fmt.Sprintf(" %d DRY RUNS SCHEDULED: only logged ", n)
+		}
+		b.WriteString(" ")
+		b.WriteString(dryRunStyle.Render(banner))
+	}
 	b.WriteString("\n")
 
 	// Current filter/user
-	filterInfo := fmt.Sprintf("onlyMine=%v", m.onlyMine)
+	filterInfo := "filter=none"
+	if f := m.filter.String(); f != "" {
+		filterInfo = "filter=" + f
+	}
+	if len(m.repos) > 0 {
+		filterInfo += " | repos=" + strings.Join(m.repos, ",")
+	}
 	if m.me != "" {
 		filterInfo += " | me=@" + m.me
 	}
@@ -741,10 +1268,51 @@ func (m model) View() string {
 	if m.mode == modeScheduling {
 		b.WriteString("Enter schedule time (local):\n")
 		b.WriteString(m.input.View())
+		b.WriteString("\n")
+		// Live preview of what the input resolves to.
+		if when, err := parseScheduleTime(m.input.Value(), m.now); err != nil {
+			b.WriteString(statusStyle.Render("  " + err.Error()))
+		} else {
+			b.WriteString(statusStyle.Render("  → " + describeScheduleTime(when, m.now)))
+		}
 		b.WriteString("\n\n")
 	} else if m.mode == modeTimePicker {
 		b.WriteString(m.timePicker.View())
 		b.WriteString("\n")
+		if !m.rescheduling {
+			b.WriteString(statusStyle.Render(fmt.Sprintf("Give up verifying the merge after %s (+/- to change)", formatVerifyTimeout(m.schedVerify))))
+			b.WriteString("\n")
+		}
+	} else if m.mode == modeMethodPicker {
+		b.WriteString(m.methodPicker.View())
+		b.WriteString("\n")
+		update := m.schedUpdate
+		if update == "" {
+			update = "off"
+		}
+		b.WriteString(statusStyle.Render(fmt.Sprintf("Update the branch when it is behind: %s (u to change)", update)))
+		b.WriteString("\n")
+	} else if m.mode == modeFilter {
+		b.WriteString("Filter the PRs: mine, label:<name>, base:<branch>, draft, ready,\n")
+		b.WriteString("review:<approved|changes|required|none>, requested, assignee:<login|me>\n")
+		b.WriteString(m.filterInput.View())
+		b.WriteString("\n")
+		// Live check of what was typed so far.
+		if _, err := parsePRFilter(m.filterInput.Value()); err != nil {
+			b.WriteString(statusStyle.Render("  " + err.Error()))
+		}
+		b.WriteString("\n\n")
+	} else if m.mode == modeDetail {
+		if m.detail == nil {
+			b.WriteString(fmt.Sprintf("Loading PR %s...\n", m.detailFor.ref()))
+		} else {
+			var sched *scheduledMerge
+			if s, ok := latestSchedule(m.scheduled, m.detailFor); ok {
+				sched = &s
+			}
+			b.WriteString(m.detail.render(sched, m.now))
+		}
+		b.WriteString("\n")
 	} else {
 		b.WriteString(m.list.View())
 		b.WriteString("\n")
@@ -752,24 +1320,42 @@ func (m model) View() string {
 
 	// Scheduled jobs summary (short)
 	if len(m.scheduled) > 0 {
-		b.WriteString("Scheduled merges:\n")
-		for _, s := range m.scheduled {
-			state := "pending"
-			if s.Done {
-				state = "done"
-			} else if s.MergeTriggered && !s.CheckScheduled {
-				state = "auto-merge set, waiting to check"
-			} else if s.CheckScheduled && !s.Done {
-				state = "checking..."
+		if m.mode == modeSchedules {
+			b.WriteString(headerStyle.Render("Scheduled merges:"))
+			b.WriteString("\n")
+		} else {
+			b.WriteString("Scheduled merges (tab to manage):\n")
+		}
+		for i, s := range m.scheduled {
+			cursor := "  "
+			if m.mode == modeSchedules && i == m.schedCursor {
+				cursor = "> "
+			}
+			b.WriteString(cursor)
+			if s.DryRun {
+				b.WriteString(dryRunStyle.Render(" DRY RUN ") + " ")
 			}
-			b.WriteString(fmt.Sprintf("  #%d at %s [%s]",
-				s.PR.Number,
+			b.WriteString(fmt.Sprintf("%s at %s (%s) [%s]",
+				s.PR.ref(),
 				s.When.Format("2006-01-02 15:04"),
-				state,
+				s.MergeMethod.label(),
+				s.stateLabel(),
 			))
+			if len(s.DependsOn) > 0 {
+				b.WriteString(" after " + strings.Join(s.dependencyRefs(), ", "))
+			}
+			if progress := s.verifyProgress(m.now); progress != "" {
+				b.WriteString(" (" + progress + ")")
+			}
 			if s.LastMessage != "" {
 				b.WriteString(" - " + s.LastMessage)
 			}
+			if s.Warning != "" && !s.done() {
+				b.WriteString(errStyle.Render(" (" + s.Warning + ")"))
+			}
+			if s.NewHeadSHA != "" && !s.done() {
+				b.WriteString(errStyle.Render(" (a to re-confirm)"))
+			}
 			b.WriteString("\n")
 		}
 		b.WriteString("\n")
@@ -789,7 +1375,17 @@ func (m model) View() string {
 // ---------- main ----------
 
 func main() {
-	p := tea.NewProgram(initialModel())
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		audit.setSource("cli", lookupAuditUser)
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+	audit.setSource("tui", nil) // the user comes from fetchMeCmd
+	repos, dryRun, err := parseRootArgs(os.Args[1:])
+	if err != nil {
+		os.Exit(usageError(err))
+	}
+
+	p := tea.NewProgram(initialModel(repos, dryRun))
 	if err := p.Start(); err != nil {
 		fmt.Println("Error:", err)
 		os.Exit(1)
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// ---------- Notifications ----------
+
+// The events a schedule reports to the notifiers.
+const (
+	eventScheduled = "scheduled"
+	eventMerged    = "merged"
+	eventFailed    = "failed"
+	eventCancelled = "cancelled"
+)
+
+var notifyEvents = []string{eventScheduled, eventMerged, eventFailed, eventCancelled}
+
+// notification is what a Notifier delivers.
+type notification struct {
+	Event   string // one of notifyEvents
+	PR      pr
+	When    time.Time // scheduled merge time
+	Message string    // the schedule's last message
+	Time    time.Time // when the event happened
+}
+
+// subject is a one-line summary, e.g. "PR merged: my-org/api#123".
+func (n notification) subject() string {
+	return fmt.Sprintf("PR %s: %s", n.Event, n.PR.ref())
+}
+
+// text is the plain-text body.
+func (n notification) text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n", n.PR.Title)
+	if n.Message != "" {
+		fmt.Fprintf(&b, "%s\n", n.Message)
+	}
+	fmt.Fprintf(&b, "Scheduled for %s\n", n.When.Format("2006-01-02 15:04"))
+	if n.PR.URL != "" {
+		fmt.Fprintf(&b, "%s\n", n.PR.URL)
+	}
+	return b.String()
+}
+
+// Notifier delivers notifications to one destination.
+type Notifier interface {
+	Notify(n notification) error
+}
+
+// notifierConfig is an entry of the "notifications" list of the config file.
+// Which fields apply depends on Type.
+type notifierConfig struct {
+	// Type is desktop, webhook, slack, ntfy or email.
+	Type string `json:"type"`
+	// Events are the events to send; empty means all of them.
+	Events []string `json:"events"`
+
+	URL     string            `json:"url"`     // webhook and slack
+	Headers map[string]string `json:"headers"` // webhook
+
+	Server string `json:"server"` // ntfy, default https://ntfy.sh
+	Topic  string `json:"topic"`  // ntfy
+	Token  string `json:"token"`  // ntfy access token, optional
+
+	SMTP     string   `json:"smtp"` // email: "host:port"
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+}
+
+// Without a "notifications" section, failures raise a desktop notification.
+var defaultNotifications = []notifierConfig{{Type: "desktop", Events: []string{eventFailed}}}
+
+// notifiers routes each notification to the notifiers subscribed to its
+// event.
+type notifiers []routedNotifier
+
+type routedNotifier struct {
+	name     string
+	events   map[string]bool
+	notifier Notifier
+}
+
+func newNotifiers(configs []notifierConfig) (notifiers, error) {
+	if configs == nil {
+		configs = defaultNotifications
+	}
+	var ns notifiers
+	for i, nc := range configs {
+		n, err := newNotifier(nc)
+		if err != nil {
+			return nil, fmt.Errorf("notifications[%d]: %w", i, err)
+		}
+		events := nc.Events
+		if len(events) == 0 {
+			events = notifyEvents
+		}
+		rn := routedNotifier{name: nc.Type, events: make(map[string]bool), notifier: n}
+		for _, ev := range events {
+			if !slices.Contains(notifyEvents, ev) {
+				return nil, fmt.Errorf("notifications[%d]: unknown event %q (want %s)", i, ev, strings.Join(notifyEvents, ", "))
+			}
+			rn.events[ev] = true
+		}
+		ns = append(ns, rn)
+	}
+	return ns, nil
+}
+
+func newNotifier(nc notifierConfig) (Notifier, error) {
+	switch nc.Type {
+	case "desktop":
+		return desktopNotifier{}, nil
+	case "webhook":
+		if nc.URL == "" {
+			return nil, errors.New("webhook needs a url")
+		}
+		return webhookNotifier{url: nc.URL, headers: nc.Headers}, nil
+	case "slack":
+		if nc.URL == "" {
+			return nil, errors.New("slack needs the incoming webhook url")
+		}
+		return slackNotifier{url: nc.URL}, nil
+	case "ntfy":
+		if nc.Topic == "" {
+			return nil, errors.New("ntfy needs a topic")
+		}
+		server := nc.Server
+		if server == "" {
+			server = "https://ntfy.sh"
+		}
+		return ntfyNotifier{server: strings.TrimSuffix(server, "/"), topic: nc.Topic, token: nc.Token}, nil
+	case "email":
+		if nc.SMTP == "" || nc.From == "" || len(nc.To) == 0 {
+			return nil, errors.New("email needs smtp, from and to")
+		}
+		if _, _, err := net.SplitHostPort(nc.SMTP); err != nil {
+			return nil, fmt.Errorf("email: invalid smtp address %q, want host:port", nc.SMTP)
+		}
+		return emailNotifier{addr: nc.SMTP, username: nc.Username, password: nc.Password, from: nc.From, to: nc.To}, nil
+	}
+	return nil, fmt.Errorf("unknown notifier type %q (want desktop, webhook, slack, ntfy or email)", nc.Type)
+}
+
+// send delivers n to every notifier subscribed to its event and reports the
+// ones that failed.
+func (ns notifiers) send(n notification) error {
+	var errs []error
+	for _, rn := range ns {
+		if !rn.events[n.Event] {
+			continue
+		}
+		if err := rn.notifier.Notify(n); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", rn.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// notifyResultMsg reports a notification that was sent, or failed to.
+type notifyResultMsg struct {
+	repo     string
+	prNumber int
+	event    string
+	err      error
+}
+
+// notifyCmd sends the notification of an event of s.
+func notifyCmd(send func(notification) error, event string, s scheduledMerge, now time.Time) tea.Cmd {
+	n := notification{Event: event, PR: s.PR, When: s.When, Message: s.LastMessage, Time: now}
+	return func() tea.Msg {
+		err := send(n)
+		entry := auditEntry{Repo: s.PR.Repo, PR: s.PR.Number, Action: "notify." + event, Detail: n.subject()}
+		if err != nil {
+			entry.Error = err.Error()
+		}
+		audit.record(entry)
+		return notifyResultMsg{repo: s.PR.Repo, prNumber: s.PR.Number, event: event, err: err}
+	}
+}
+
+// ---------- Notifier backends ----------
+
+var notifyHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// postJSON posts payload to url and fails on a non-2xx answer.
+func postJSON(url string, headers map[string]string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return doNotifyRequest(req)
+}
+
+func doNotifyRequest(req *http.Request) error {
+	resp, err := notifyHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned %s: %s", req.URL.Host, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// desktopNotifier raises a desktop notification with notify-send.
+type desktopNotifier struct{}
+
+func (desktopNotifier) Notify(n notification) error {
+	urgency := "normal"
+	if n.Event == eventFailed {
+		urgency = "critical"
+	}
+	return exec.Command("notify-send", n.subject(), n.text(), "-u", urgency).Run()
+}
+
+// webhookNotifier posts the notification as JSON to any URL.
+type webhookNotifier struct {
+	url     string
+	headers map[string]string
+}
+
+// webhookPayload is the stable JSON shape posted by webhookNotifier.
+type webhookPayload struct {
+	Event   string    `json:"event"`
+	Repo    string    `json:"repo"`
+	PR      int       `json:"pr"`
+	Title   string    `json:"title"`
+	URL     string    `json:"url"`
+	Author  string    `json:"author"`
+	When    time.Time `json:"when"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+func (w webhookNotifier) Notify(n notification) error {
+	return postJSON(w.url, w.headers, webhookPayload{
+		Event:   n.Event,
+		Repo:    n.PR.Repo,
+		PR:      n.PR.Number,
+		Title:   n.PR.Title,
+		URL:     n.PR.URL,
+		Author:  n.PR.Author,
+		When:    n.When,
+		Message: n.Message,
+		Time:    n.Time,
+	})
+}
+
+// slackNotifier posts to a Slack incoming webhook.
+type slackNotifier struct {
+	url string
+}
+
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func (s slackNotifier) Notify(n notification) error {
+	ref := n.PR.ref()
+	if n.PR.URL != "" {
+		ref = fmt.Sprintf("<%s|%s>", n.PR.URL, ref)
+	}
+	text := fmt.Sprintf("*PR %s*: %s %s", n.Event, ref, slackEscaper.Replace(n.PR.Title))
+	if n.Message != "" {
+		text += "\n" + slackEscaper.Replace(n.Message)
+	}
+	return postJSON(s.url, nil, map[string]string{"text": text})
+}
+
+// ntfyNotifier publishes to an ntfy topic.
+type ntfyNotifier struct {
+	server, topic, token string
+}
+
+var ntfyTags = map[string]string{
+	eventScheduled: "alarm_clock",
+	eventMerged:    "white_check_mark",
+	eventFailed:    "x",
+	eventCancelled: "no_entry",
+}
+
+func (t ntfyNotifier) Notify(n notification) error {
+	req, err := http.NewRequest(http.MethodPost, t.server+"/"+t.topic, strings.NewReader(n.text()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Title", n.subject())
+	req.Header.Set("Tags", ntfyTags[n.Event])
+	if n.Event == eventFailed {
+		req.Header.Set("Priority", "high")
+	}
+	if n.PR.URL != "" {
+		req.Header.Set("Click", n.PR.URL)
+	}
+	if t.token != "" {
+		req.Header.Set("Authorization", "Bearer "+t.token)
+	}
+	return doNotifyRequest(req)
+}
+
+// emailNotifier sends a plain-text mail over SMTP, with STARTTLS when the
+// server offers it.
+type emailNotifier struct {
+	addr               string // host:port
+	username, password string // no authentication when empty
+	from               string
+	to                 []string
+}
+
+func (m emailNotifier) Notify(n notification) error {
+	var auth smtp.Auth
+	if m.username != "" {
+		host, _, _ := net.SplitHostPort(m.addr)
+		auth = smtp.PlainAuth("", m.username, m.password, host)
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", m.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(m.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", n.subject())
+	fmt.Fprintf(&msg, "Date: %s\r\n", n.Time.Format(time.RFC1123Z))
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(n.text(), "\n", "\r\n"))
+	return smtp.SendMail(m.addr, auth, m.from, m.to, msg.Bytes())
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testNotification(event string) notification {
+	return notification{
+		Event:   event,
+		PR:      pr{Repo: "acme/app", Number: 12, Title: "Fix <login> & logout", Author: "bob", URL: "https://github.com/acme/app/pull/12"},
+		When:    time.Date(2026, 10, 14, 18, 0, 0, 0, time.UTC),
+		Message: "PR is merged",
+		Time:    time.Date(2026, 10, 14, 18, 3, 0, 0, time.UTC),
+	}
+}
+
+// capturedRequest is what a notifier sent to an httptest server.
+type capturedRequest struct {
+	method string
+	header http.Header
+	body   string
+}
+
+// notifyServer records the request it gets and answers with status.
+func notifyServer(t *testing.T, status int, got *capturedRequest) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		*got = capturedRequest{method: r.Method, header: r.Header.Clone(), body: string(body)}
+		w.WriteHeader(status)
+		io.WriteString(w, "no such hook\n")
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var got capturedRequest
+	srv := notifyServer(t, http.StatusNoContent, &got)
+	n := webhookNotifier{url: srv.URL + "/hook", headers: map[string]string{"X-Token": "secret"}}
+	if err := n.Notify(testNotification(eventMerged)); err != nil {
+		t.Fatal(err)
+	}
+	if got.method != http.MethodPost || got.header.Get("Content-Type") != "application/json" || got.header.Get("X-Token") != "secret" {
+		t.Errorf("got %s with headers %v", got.method, got.header)
+	}
+	var payload map[string]any
+	if err := json.Unmarshal([]byte(got.body), &payload); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"event":   "merged",
+		"repo":    "acme/app",
+		"pr":      float64(12),
+		"title":   "Fix <login> & logout",
+		"url":     "https://github.com/acme/app/pull/12",
+		"author":  "bob",
+		"when":    "2026-10-14T18:00:00Z",
+		"message": "PR is merged",
+		"time":    "2026-10-14T18:03:00Z",
+	}
+	if len(payload) != len(want) {
+		t.Errorf("payload = %v, want %v", payload, want)
+	}
+	for k, v := range want {
+		if payload[k] != v {
+			t.Errorf("payload[%q] = %v, want %v", k, payload[k], v)
+		}
+	}
+}
+
+func TestSlackNotifier(t *testing.T) {
+	var got capturedRequest
+	srv := notifyServer(t, http.StatusOK, &got)
+	if err := (slackNotifier{url: srv.URL}).Notify(testNotification(eventFailed)); err != nil {
+		t.Fatal(err)
+	}
+	var payload map[string]string
+	if err := json.Unmarshal([]byte(got.body), &payload); err != nil {
+		t.Fatal(err)
+	}
+	want := "*PR failed*: <https://github.com/acme/app/pull/12|acme/app#12> Fix &lt;login&gt; &amp; logout\nPR is merged"
+	if payload["text"] != want {
+		t.Errorf("text = %q, want %q", payload["text"], want)
+	}
+}
+
+func TestNtfyNotifier(t *testing.T) {
+	tests := []struct {
+		event        string
+		token        string
+		wantPriority string
+		wantAuth     string
+	}{
+		{event: eventMerged},
+		{event: eventFailed, token: "tk_secret", wantPriority: "high", wantAuth: "Bearer tk_secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.event, func(t *testing.T) {
+			var got capturedRequest
+			srv := notifyServer(t, http.StatusOK, &got)
+			n := ntfyNotifier{server: srv.URL, topic: "merges", token: tt.token}
+			if err := n.Notify(testNotification(tt.event)); err != nil {
+				t.Fatal(err)
+			}
+			wantHeaders := map[string]string{
+				"Title":         "PR " + tt.event + ": acme/app#12",
+				"Tags":          ntfyTags[tt.event],
+				"Click":         "https://github.com/acme/app/pull/12",
+				"Priority":      tt.wantPriority,
+				"Authorization": tt.wantAuth,
+			}
+			for k, v := range wantHeaders {
+				if got.header.Get(k) != v {
+					t.Errorf("%s = %q, want %q", k, got.header.Get(k), v)
+				}
+			}
+			if !strings.Contains(got.body, "Fix <login> & logout\nPR is merged\n") {
+				t.Errorf("body = %q", got.body)
+			}
+		})
+	}
+}
+
+func TestHTTPNotifiersReportFailures(t *testing.T) {
+	var got capturedRequest
+	srv := notifyServer(t, http.StatusNotFound, &got)
+	for name, n := range map[string]Notifier{
+		"webhook": webhookNotifier{url: srv.URL},
+		"slack":   slackNotifier{url: srv.URL},
+		"ntfy":    ntfyNotifier{server: srv.URL, topic: "merges"},
+	} {
+		err := n.Notify(testNotification(eventMerged))
+		if err == nil || !strings.Contains(err.Error(), "404") || !strings.Contains(err.Error(), "no such hook") {
+			t.Errorf("%s: err = %v, want the 404 and its body", name, err)
+		}
+	}
+}
+
+func TestNotifiersRouteEvents(t *testing.T) {
+	var got capturedRequest
+	srv := notifyServer(t, http.StatusOK, &got)
+	ns, err := newNotifiers([]notifierConfig{{Type: "webhook", URL: srv.URL, Events: []string{eventFailed}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ns.send(testNotification(eventMerged)); err != nil || got.method != "" {
+		t.Fatalf("merged was sent to a notifier subscribed to failed only (err %v)", err)
+	}
+	if err := ns.send(testNotification(eventFailed)); err != nil || got.method != http.MethodPost {
+		t.Fatalf("failed was not sent (err %v)", err)
+	}
+}
+
+// smtpMessage is a mail received by smtpServer.
+type smtpMessage struct {
+	auth     string // decoded AUTH PLAIN credentials, "" without
+	from     string
+	to       []string
+	data     string
+	greeting string // the EHLO argument
+}
+
+// smtpServer is a minimal SMTP stand-in on localhost: it accepts one mail,
+// offering AUTH PLAIN but no STARTTLS, and sends it on the returned channel.
+func smtpServer(t *testing.T) (addr string, received <-chan smtpMessage) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	ch := make(chan smtpMessage, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+		var msg smtpMessage
+		reply("220 localhost ESMTP test")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			verb, arg, _ := strings.Cut(line, " ")
+			switch strings.ToUpper(verb) {
+			case "EHLO":
+				msg.greeting = arg
+				reply("250-localhost")
+				reply("250 AUTH PLAIN")
+			case "AUTH":
+				creds, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(arg, "PLAIN "))
+				msg.auth = string(creds)
+				reply("235 2.7.0 Authentication successful")
+			case "MAIL":
+				msg.from = arg
+				reply("250 OK")
+			case "RCPT":
+				msg.to = append(msg.to, arg)
+				reply("250 OK")
+			case "DATA":
+				reply("354 End data with <CR><LF>.<CR><LF>")
+				var data strings.Builder
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if l == ".\r\n" {
+						break
+					}
+					data.WriteString(l)
+				}
+				msg.data = data.String()
+				reply("250 OK queued")
+			case "QUIT":
+				reply("221 Bye")
+				ch <- msg
+				return
+			default:
+				reply("502 Command not implemented")
+			}
+		}
+	}()
+	return ln.Addr().String(), ch
+}
+
+func TestEmailNotifier(t *testing.T) {
+	addr, received := smtpServer(t)
+	m := emailNotifier{
+		addr:     addr,
+		username: "bot",
+		password: "hunter2",
+		from:     "bot@example.com",
+		to:       []string{"dev@example.com", "ops@example.com"},
+	}
+	if err := m.Notify(testNotification(eventFailed)); err != nil {
+		t.Fatal(err)
+	}
+	var msg smtpMessage
+	select {
+	case msg = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the SMTP server got no mail")
+	}
+	if msg.auth != "\x00bot\x00hunter2" {
+		t.Errorf("authenticated as %q", msg.auth)
+	}
+	if msg.from != "FROM:<bot@example.com>" || len(msg.to) != 2 || msg.to[1] != "TO:<ops@example.com>" {
+		t.Errorf("envelope from %q to %q", msg.from, msg.to)
+	}
+	for _, want := range []string{
+		"From: bot@example.com\r\n",
+		"To: dev@example.com, ops@example.com\r\n",
+		"Subject: PR failed: acme/app#12\r\n",
+		"Date: Wed, 14 Oct 2026 18:03:00 +0000\r\n",
+		"\r\n\r\nFix <login> & logout\r\nPR is merged\r\nScheduled for 2026-10-14 18:00\r\n",
+	} {
+		if !strings.Contains(msg.data, want) {
+			t.Errorf("mail lacks %q:\n%s", want, msg.data)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ---------- Retry policy ----------
+
+// A retryPolicy decides whether a failed merge step (enabling auto-merge or
+// checking the merge) is tried again, and when. Only transient errors are
+// retried; anything else fails the step right away.
+type retryPolicy struct {
+	maxAttempts int             // attempts per step, the first one included
+	backoff     time.Duration   // wait before the first retry, doubled after each
+	retryOn     map[string]bool // error classes to retry, see errorClass
+}
+
+// retryConfig is the "retry" section of the config file.
+type retryConfig struct {
+	// MaxAttempts is how often a step is attempted in total (default 5; 1
+	// disables retries).
+	MaxAttempts int `json:"max_attempts"`
+	// Backoff is the wait before the first retry, e.g. "30s" (the default).
+	Backoff string `json:"backoff"`
+	// RetryOn lists the error classes to retry: "network", "5xx" and
+	// "rate_limit" (default all three).
+	RetryOn []string `json:"retry_on"`
+}
+
+const (
+	defaultRetryAttempts = 5
+	defaultRetryBackoff  = 30 * time.Second
+	maxRetryBackoff      = 10 * time.Minute
+)
+
+var errorClasses = []string{"network", "5xx", "rate_limit"}
+
+func newRetryPolicy(rc retryConfig) (retryPolicy, error) {
+	p := retryPolicy{
+		maxAttempts: defaultRetryAttempts,
+		backoff:     defaultRetryBackoff,
+		retryOn:     make(map[string]bool),
+	}
+	if rc.MaxAttempts < 0 {
+		return p, fmt.Errorf("retry: invalid max_attempts %d", rc.MaxAttempts)
+	}
+	if rc.MaxAttempts > 0 {
+		p.maxAttempts = rc.MaxAttempts
+	}
+	if rc.Backoff != "" {
+		d, err := time.ParseDuration(rc.Backoff)
+		if err != nil || d <= 0 {
+			return p, fmt.Errorf("retry: invalid backoff %q", rc.Backoff)
+		}
+		p.backoff = d
+	}
+	classes := rc.RetryOn
+	if classes == nil {
+		classes = errorClasses
+	}
+	for _, class := range classes {
+		if !slices.Contains(errorClasses, class) {
+			return p, fmt.Errorf("retry: unknown error class %q (want %s)", class, strings.Join(errorClasses, ", "))
+		}
+		p.retryOn[class] = true
+	}
+	return p, nil
+}
+
+// next returns how long to wait before another attempt after attempt
+// number attempt (1 for the first) failed with err, or false when the step
+// has failed for good.
+func (p retryPolicy) next(attempt int, err error) (time.Duration, bool) {
+	if attempt >= p.maxAttempts || !p.retryOn[errorClass(err)] {
+		return 0, false
+	}
+	delay := p.backoff
+	for i := 1; i < attempt && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryBackoff), true
+}
+
+// gh reports HTTP failures and network trouble only in its output.
+var (
+	ghRateLimitMarkers = []string{"rate limit", "HTTP 429"}
+	ghServerMarkers    = []string{"HTTP 500", "HTTP 502", "HTTP 503", "HTTP 504"}
+	ghNetworkMarkers   = []string{
+		"connection refused", "connection reset", "i/o timeout", "no such host",
+		"TLS handshake timeout", "could not resolve", "unexpected EOF",
+		"error connecting to",
+	}
+)
+
+// GitHub refuses to merge, or to set auto-merge, with an expected head commit
+// the branch has moved off with one of these (lowercased).
+var headMovedMarkers = []string{"head branch was modified", "expected head", "expectedheadoid"}
+
+// headMoved reports whether err says the PR branch no longer points at the
+// commit the merge was pinned to.
+func headMoved(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	return slices.ContainsFunc(headMovedMarkers, func(marker string) bool { return strings.Contains(msg, marker) })
+}
+
+// errorClass sorts an error from a GitHub backend into "network", "5xx",
+// "rate_limit", or "" for errors not worth retrying.
+func errorClass(err error) string {
+	if err == nil {
+		return ""
+	}
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.StatusCode == 429,
+			apiErr.StatusCode == 403 && strings.Contains(strings.ToLower(apiErr.Message), "rate limit"):
+			return "rate_limit"
+		case apiErr.StatusCode >= 500:
+			return "5xx"
+		}
+		return ""
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return "network"
+	}
+	msg := err.Error()
+	for _, class := range []struct {
+		name    string
+		markers []string
+	}{
+		{"rate_limit", ghRateLimitMarkers},
+		{"5xx", ghServerMarkers},
+		{"network", ghNetworkMarkers},
+	} {
+		for _, marker := range class.markers {
+			if strings.Contains(msg, marker) {
+				return class.name
+			}
+		}
+	}
+	return ""
+}
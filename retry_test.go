@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestNewRetryPolicy(t *testing.T) {
+	p, err := newRetryPolicy(retryConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.maxAttempts != defaultRetryAttempts || p.backoff != defaultRetryBackoff || len(p.retryOn) != len(errorClasses) {
+		t.Errorf("defaults = %+v", p)
+	}
+
+	// An empty list retries nothing, unlike a missing one.
+	p, err = newRetryPolicy(retryConfig{MaxAttempts: 3, Backoff: "1m", RetryOn: []string{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.maxAttempts != 3 || p.backoff != time.Minute || len(p.retryOn) != 0 {
+		t.Errorf("policy = %+v", p)
+	}
+
+	for _, rc := range []retryConfig{
+		{MaxAttempts: -1},
+		{Backoff: "soon"},
+		{Backoff: "-5s"},
+		{RetryOn: []string{"network", "4xx"}},
+	} {
+		if _, err := newRetryPolicy(rc); err == nil {
+			t.Errorf("newRetryPolicy(%+v) succeeded", rc)
+		}
+	}
+}
+
+func TestRetryPolicyNext(t *testing.T) {
+	transient := &apiError{StatusCode: 502, Message: "Bad Gateway"}
+	tests := []struct {
+		name    string
+		rc      retryConfig
+		attempt int
+		err     error
+		want    time.Duration
+		wantOK  bool
+	}{
+		{"first retry", retryConfig{}, 1, transient, 30 * time.Second, true},
+		{"doubles", retryConfig{}, 2, transient, time.Minute, true},
+		{"doubles again", retryConfig{}, 4, transient, 4 * time.Minute, true},
+		{"out of attempts", retryConfig{}, 5, transient, 0, false},
+		{"capped", retryConfig{MaxAttempts: 10, Backoff: "3m"}, 3, transient, maxRetryBackoff, true},
+		{"stays capped", retryConfig{MaxAttempts: 100}, 60, transient, maxRetryBackoff, true},
+		{"retries off", retryConfig{MaxAttempts: 1}, 1, transient, 0, false},
+		{"not transient", retryConfig{}, 1, errors.New("GraphQL: Pull request is in clean status"), 0, false},
+		{"class not retried", retryConfig{RetryOn: []string{"network"}}, 1, transient, 0, false},
+		{"class retried", retryConfig{RetryOn: []string{"rate_limit"}}, 1, &apiError{StatusCode: 429}, 30 * time.Second, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := newRetryPolicy(tt.rc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := p.next(tt.attempt, tt.err)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("next(%d) = %s, %v, want %s, %v", tt.attempt, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"nil", nil, ""},
+		{"API 429", &apiError{StatusCode: 429, Message: "Too Many Requests"}, "rate_limit"},
+		{"API 403 rate limit", &apiError{StatusCode: 403, Message: "API rate limit exceeded for user ID 1."}, "rate_limit"},
+		{"API 403", &apiError{StatusCode: 403, Message: "Resource not accessible by integration"}, ""},
+		{"API 502", &apiError{StatusCode: 502, Message: "Bad Gateway"}, "5xx"},
+		{"API 422", &apiError{StatusCode: 422, Message: "Validation Failed"}, ""},
+		{"wrapped API 503", fmt.Errorf("enabling auto-merge: %w", &apiError{StatusCode: 503}), "5xx"},
+		// Mentions a rate limit, but the status code decides.
+		{"API 404", &apiError{StatusCode: 404, Message: "rate limit docs moved"}, ""},
+		{"net.Error", &net.DNSError{Err: "no such host", Name: "api.github.com", IsTimeout: true}, "network"},
+		{"wrapped net.Error", fmt.Errorf("request failed: %w", &net.OpError{Op: "dial", Err: errors.New("connection refused")}), "network"},
+		{"gh rate limit", errors.New("gh: API rate limit exceeded for user ID 1 (HTTP 403)"), "rate_limit"},
+		{"gh 429", errors.New("gh: HTTP 429: Too Many Requests"), "rate_limit"},
+		{"gh 504", errors.New("gh: HTTP 504: Gateway Timeout"), "5xx"},
+		{"gh offline", errors.New("error connecting to api.github.com"), "network"},
+		{"gh timeout", errors.New("Post \"https://api.github.com/graphql\": net/http: TLS handshake timeout"), "network"},
+		{"gh refusal", errors.New("GraphQL: Pull request is in clean status (enablePullRequestAutoMerge)"), ""},
+		{"gh 404", errors.New("gh: HTTP 404: Not Found"), ""},
+	}
+	for _, tt := range tests {
+		if got := errorClass(tt.err); got != tt.want {
+			t.Errorf("%s: errorClass(%v) = %q, want %q", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestHeadMoved(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("GraphQL: Head branch was modified. Review and try the merge again. (enablePullRequestAutoMerge)"), true},
+		{&apiError{StatusCode: 422, Message: "Expected head OID abc123 but found def456"}, true},
+		{errors.New(`Variable $expectedHeadOid of type GitObjectID was provided invalid value`), true},
+		{&apiError{StatusCode: 502, Message: "Bad Gateway"}, false},
+	} {
+		if got := headMoved(tt.err); got != tt.want {
+			t.Errorf("headMoved(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
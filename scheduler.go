@@ -0,0 +1,1169 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// The scheduling pipeline: pre-merge comment, enabling auto-merge, merge
+// check, and on failure disabling auto-merge plus a failure comment. It only
+// operates on a slice of schedules and returns side effects as tea.Cmd values,
+// so the daemon can drive it without a Bubble Tea program.
+
+// How GitHub should merge the PR once auto-merge kicks in.
+type mergeMethod string
+
+const (
+	mergeMethodMerge  mergeMethod = "merge"
+	mergeMethodSquash mergeMethod = "squash"
+	mergeMethodRebase mergeMethod = "rebase"
+)
+
+var mergeMethods = []mergeMethod{mergeMethodMerge, mergeMethodSquash, mergeMethodRebase}
+
+// parseMergeMethod validates a merge method name. The empty string is
+// accepted and means "use the default".
+func parseMergeMethod(s string) (mergeMethod, error) {
+	if s == "" {
+		return "", nil
+	}
+	for _, mm := range mergeMethods {
+		if string(mm) == s {
+			return mm, nil
+		}
+	}
+	return "", fmt.Errorf("unknown merge method %q (want merge, squash or rebase)", s)
+}
+
+// ghFlag returns the `gh pr merge` flag selecting the method. An unset method
+// is a regular merge.
+func (mm mergeMethod) ghFlag() string {
+	return "--" + mm.label()
+}
+
+func (mm mergeMethod) label() string {
+	if mm == "" {
+		return string(mergeMethodMerge)
+	}
+	return string(mm)
+}
+
+// How often the merge state of unmerged dependencies, and the checks of a
+// retargeted PR, are polled once a schedule is due.
+const (
+	dependencyPollInterval = 30 * time.Second
+	checksPollInterval     = 30 * time.Second
+)
+
+// Until its merge starts, the PR of a schedule is refreshed every
+// watchInterval, to catch it being closed, merged by hand, turned back into
+// a draft, getting conflicts or new commits.
+const watchInterval = 2 * time.Minute
+
+// Once auto-merge is set, the merge is verified after firstVerifyDelay, then
+// at doubling intervals of at most maxVerifyInterval until the deadline.
+const (
+	firstVerifyDelay  = time.Minute
+	maxVerifyInterval = 10 * time.Minute
+)
+
+// maxBranchUpdates bounds how often a schedule updates a branch that keeps
+// falling behind a busy base.
+const maxBranchUpdates = 5
+
+// dependency is a PR that has to be merged before a schedule may fire.
+type dependency struct {
+	PR       pr
+	Merged   bool
+	Checking bool // a merge check is in flight
+}
+
+// For scheduling auto-merge of a PR.
+type scheduledMerge struct {
+	PR                pr
+	When              time.Time
+	MergeMethod       mergeMethod
+	HeadSHA           string       `json:",omitempty"` // commit confirmed when scheduling; nothing else is merged
+	DryRun            bool         `json:",omitempty"` // only log the calls that would change the PR
+	DependsOn         []dependency `json:",omitempty"`
+	DependencyCheckAt time.Time    // next poll of the unmerged dependencies
+	RetargetTo        string       `json:",omitempty"` // stacked PR: base branch to move to once its dependencies merged
+	Retargeted        bool
+	Gate              bool      // hold the merge until checks passed and the PR is approved
+	ChecksPassed      bool      // the gate (or a retargeted PR's checks) passed
+	ChecksCheckAt     time.Time // next poll of the checks
+	ChecksDeadline    time.Time // when to give up waiting for them
+	ChecksStatus      string    `json:",omitempty"` // what the checks were last found waiting for
+	HeadCheckAt       time.Time // next check of the head commit, after a failed one
+	HeadChecking      bool      // a head check is in flight
+	HeadVerified      bool      // the head was still HeadSHA when the merge fell due
+	NewHeadSHA        string    `json:",omitempty"` // commit pushed since HeadSHA; the merge waits for re-confirmation
+	WatchAt           time.Time // next refresh of the PR, see watchInterval
+	Watching          bool      // a refresh is in flight
+	Warning           string    `json:",omitempty"` // why the PR may not merge, e.g. it is a draft again
+	State             scheduleState
+	UpdateBranch      string        `json:",omitempty"` // "merge" or "rebase" to update the branch when it is behind
+	BranchUpdates     int           // branch updates made so far
+	VerifyTimeout     time.Duration // how long to verify the merge; 0 uses the config
+	VerifyDeadline    time.Time     // give up verifying after this
+	CheckAttempts     int           // merge checks made so far
+	CheckAt           time.Time
+	FailureReason     string    `json:",omitempty"` // why the merge is given up on, for the failure comment
+	MergedOutside     bool      // cancelled because the PR was merged by hand; its dependents go ahead
+	Commented         bool      // the pre-merge comment is on the PR; a merge held up after it is not announced again
+	Retries           int       // failed attempts of the current step, see retryPolicy
+	RetryAt           time.Time // when to enable auto-merge again after a failure
+	FinishedAt        time.Time
+	LastMessage       string
+	History           []historyEntry `json:",omitempty"`
+	// PendingEvents are notification events (see notifyEvents) the daemon
+	// has yet to send.
+	PendingEvents []string `json:",omitempty"`
+}
+
+// shortSHA abbreviates a commit SHA for display.
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+// historyEntry is a notable event in the life of a schedule. Transitions
+// also record the states they moved between.
+type historyEntry struct {
+	At    time.Time
+	Event string
+	From  scheduleState `json:",omitempty"`
+	To    scheduleState `json:",omitempty"`
+}
+
+// record adds an event to the schedule's history.
+func (s *scheduledMerge) record(now time.Time, event string) {
+	s.History = append(s.History, historyEntry{At: now, Event: event})
+}
+
+// merged finishes the schedule once its PR merged and notifies about it.
+func (s *scheduledMerge) merged(now time.Time, message string) {
+	if s.transition(now, stateMerged, message) {
+		s.notify(eventMerged)
+	}
+}
+
+// fail finishes the schedule without merging and notifies about it.
+func (s *scheduledMerge) fail(now time.Time, message string) {
+	if s.transition(now, stateFailed, message) {
+		s.notify(eventFailed)
+	}
+}
+
+// cancel finishes the schedule on request, or because it cannot go ahead.
+func (s *scheduledMerge) cancel(now time.Time, message string) {
+	if s.transition(now, stateCancelled, message) {
+		s.notify(eventCancelled)
+	}
+}
+
+// moveTo changes when the merge falls due. What the gate found out so far is
+// forgotten: it waits for the checks afresh, with a new deadline, then.
+func (s *scheduledMerge) moveTo(when time.Time) {
+	s.When = when
+	s.ChecksPassed = false
+	s.ChecksDeadline = time.Time{}
+	s.ChecksStatus = ""
+	if !s.Retargeted {
+		// A retargeted PR needs ChecksCheckAt set to poll its checks at all.
+		s.ChecksCheckAt = time.Time{}
+	}
+}
+
+// notify queues a notification event for the daemon to send.
+func (s *scheduledMerge) notify(event string) {
+	s.PendingEvents = append(s.PendingEvents, event)
+}
+
+// stateLabel summarises how far the schedule got, for display.
+func (s scheduledMerge) stateLabel() string {
+	switch s.State {
+	case stateMerged, stateFailed, stateCancelled:
+		return string(s.State)
+	case stateCommenting:
+		return "posting comment..."
+	case stateMerging:
+		return "enabling auto-merge..."
+	case stateAwaitingMerge:
+		return "auto-merge set, waiting to check"
+	case stateVerifying:
+		return "checking..."
+	}
+	switch {
+	case s.NewHeadSHA != "":
+		return "needs re-confirmation"
+	case !s.dependenciesMerged():
+		return "waiting for dependencies"
+	case !s.ChecksDeadline.IsZero() && !s.ChecksPassed:
+		return "waiting for checks"
+	}
+	return "pending"
+}
+
+// verifyProgress describes an ongoing merge verification for display, e.g.
+// "check 3, 41m left", or "" when the merge is not being verified.
+func (s scheduledMerge) verifyProgress(now time.Time) string {
+	if !s.verifying() || s.VerifyDeadline.IsZero() {
+		return ""
+	}
+	left := max(s.VerifyDeadline.Sub(now).Round(time.Minute), 0)
+	if left >= time.Hour {
+		return fmt.Sprintf("check %d, %dh%02dm left", s.CheckAttempts+1, int(left/time.Hour), int(left%time.Hour/time.Minute))
+	}
+	return fmt.Sprintf("check %d, %dm left", s.CheckAttempts+1, int(left/time.Minute))
+}
+
+// nextVerifyCheck returns when to check the merge again after a check found
+// it not merged yet, never later than the deadline.
+func (s scheduledMerge) nextVerifyCheck(now time.Time) time.Time {
+	interval := maxVerifyInterval
+	if s.CheckAttempts < 8 {
+		interval = min(firstVerifyDelay<<s.CheckAttempts, maxVerifyInterval)
+	}
+	next := now.Add(interval)
+	if next.After(s.VerifyDeadline) {
+		next = s.VerifyDeadline
+	}
+	return next
+}
+
+func (s scheduledMerge) dependenciesMerged() bool {
+	for _, d := range s.DependsOn {
+		if !d.Merged {
+			return false
+		}
+	}
+	return true
+}
+
+// dependencyRefs lists the dependencies, e.g. "my-org/api#41 (merged)".
+func (s scheduledMerge) dependencyRefs() []string {
+	refs := make([]string, len(s.DependsOn))
+	for i, d := range s.DependsOn {
+		refs[i] = d.PR.ref()
+		if d.Merged {
+			refs[i] += " (merged)"
+		}
+	}
+	return refs
+}
+
+// dependencyFailure checks the dependencies of s against their own schedules
+// and returns why s can no longer fire, or "" if it still can. Dependencies
+// whose schedule merged them are marked as merged on the way.
+func dependencyFailure(scheduled []scheduledMerge, s *scheduledMerge) string {
+	for i := range s.DependsOn {
+		d := &s.DependsOn[i]
+		if d.Merged {
+			continue
+		}
+		// The latest schedule of the dependency tells how it ended.
+		last := -1
+		for j, other := range scheduled {
+			if other.PR.Repo == d.PR.Repo && other.PR.Number == d.PR.Number {
+				last = j
+			}
+		}
+		if last < 0 || !scheduled[last].done() {
+			continue
+		}
+		dep := scheduled[last]
+		if dep.DryRun && !s.DryRun {
+			// A dry run merged nothing: poll the dependency instead.
+			continue
+		}
+		switch {
+		case dep.State == stateMerged, dep.MergedOutside:
+			d.Merged = true
+		case dep.State == stateCancelled:
+			return d.PR.ref() + " was cancelled"
+		default:
+			return fmt.Sprintf("%s failed to merge (%s)", d.PR.ref(), dep.LastMessage)
+		}
+	}
+	return ""
+}
+
+func findScheduled(scheduled []scheduledMerge, repo string, prNumber int) int {
+	for i, s := range scheduled {
+		if s.PR.Repo == repo && s.PR.Number == prNumber && !s.done() {
+			return i
+		}
+	}
+	return -1
+}
+
+// findCancelledWhileMerging returns the index of the latest schedule of a PR
+// if it was cancelled while auto-merge was being enabled, or -1.
+func findCancelledWhileMerging(scheduled []scheduledMerge, repo string, prNumber int) int {
+	for i := len(scheduled) - 1; i >= 0; i-- {
+		s := scheduled[i]
+		if s.PR.Repo != repo || s.PR.Number != prNumber {
+			continue
+		}
+		if s.State != stateCancelled {
+			return -1
+		}
+		for j := len(s.History) - 1; j >= 0; j-- {
+			if h := s.History[j]; h.To == stateCancelled {
+				if h.From == stateMerging {
+					return i
+				}
+				return -1
+			}
+		}
+		return -1
+	}
+	return -1
+}
+
+// parseUpdateBranch validates an update-branch mode: "merge", "rebase", or
+// "" / "off", which both mean not updating and return "".
+func parseUpdateBranch(s string) (string, error) {
+	switch s {
+	case "", "off":
+		return "", nil
+	case "merge", "rebase":
+		return s, nil
+	}
+	return "", fmt.Errorf("invalid update-branch mode %q (want merge, rebase or off)", s)
+}
+
+// ---------- Messages ----------
+
+type (
+	mergeResultMsg struct {
+		repo     string
+		prNumber int
+		err      error
+	}
+	checkMergedMsg struct {
+		repo     string
+		prNumber int
+		state    string // OPEN, CLOSED or MERGED
+		// mergeState is the PR's mergeStateStatus, e.g. BEHIND; only set by
+		// checkMergeStateCmd.
+		mergeState string
+		merged     bool
+		err        error
+	}
+	updateBranchResultMsg struct {
+		repo     string
+		prNumber int
+		err      error
+	}
+	setBaseResultMsg struct {
+		repo     string
+		prNumber int
+		err      error
+	}
+	// gateStatusMsg reports what a due merge may be waiting for.
+	gateStatusMsg struct {
+		repo     string
+		prNumber int
+		checks   checksResult
+		review   string // see GitHub.ReviewDecision; "" when not gated on reviews
+		err      error
+	}
+	// dependencyCheckedMsg reports the state of a dependency of a schedule.
+	dependencyCheckedMsg struct {
+		repo     string // the dependent schedule's PR
+		prNumber int
+		dep      checkMergedMsg
+	}
+	commentResultMsg struct {
+		repo       string
+		prNumber   int
+		isPreMerge bool
+		skipped    bool // the comment is turned off in the config
+		err        error
+	}
+	disableAutoMergeResultMsg struct {
+		repo     string
+		prNumber int
+		// resumed is set when auto-merge is disabled again after a restart
+		// during failure handling; no failure comment follows.
+		resumed bool
+		err     error
+	}
+	commitSHAMsg struct {
+		repo     string
+		prNumber int
+		sha      string
+		err      error
+	}
+	// prWatchedMsg reports a pending schedule's PR as it is now.
+	prWatchedMsg struct {
+		repo     string
+		prNumber int
+		pr       pr
+		err      error
+	}
+	// headCheckedMsg reports the commit a due PR's branch points at.
+	headCheckedMsg struct {
+		repo     string
+		prNumber int
+		sha      string
+		err      error
+	}
+)
+
+// ---------- Commands (side effects) ----------
+
+// mergePRCmd enables auto-merge, only of headSHA unless it is empty.
+func mergePRCmd(gh GitHub, p pr, method mergeMethod, headSHA string) tea.Cmd {
+	return func() tea.Msg {
+		return mergeResultMsg{repo: p.Repo, prNumber: p.Number, err: gh.EnableAutoMerge(p.Number, method, headSHA)}
+	}
+}
+
+func commentPRCmd(gh GitHub, p pr, body string, isPreMerge bool) tea.Cmd {
+	return func() tea.Msg {
+		return commentResultMsg{repo: p.Repo, prNumber: p.Number, isPreMerge: isPreMerge, err: gh.Comment(p.Number, body)}
+	}
+}
+
+func disableAutoMergeCmd(gh GitHub, p pr) tea.Cmd {
+	return func() tea.Msg {
+		return disableAutoMergeResultMsg{repo: p.Repo, prNumber: p.Number, err: gh.DisableAutoMerge(p.Number)}
+	}
+}
+
+func getCommitSHACmd(gh GitHub, p pr) tea.Cmd {
+	return func() tea.Msg {
+		sha, err := gh.HeadSHA(p.Number)
+		return commitSHAMsg{repo: p.Repo, prNumber: p.Number, sha: sha, err: err}
+	}
+}
+
+// checkHeadCmd looks up the commit p's branch points at, like
+// getCommitSHACmd.
+func checkHeadCmd(gh GitHub, p pr) tea.Cmd {
+	return func() tea.Msg {
+		sha, err := gh.HeadSHA(p.Number)
+		return headCheckedMsg{repo: p.Repo, prNumber: p.Number, sha: sha, err: err}
+	}
+}
+
+func checkMergedCmd(gh GitHub, p pr) tea.Cmd {
+	return func() tea.Msg {
+		// Ask GitHub if the PR is merged.
+		state, err := gh.PRState(p.Number)
+		if err != nil {
+			return checkMergedMsg{repo: p.Repo, prNumber: p.Number, merged: false, err: err}
+		}
+		return checkMergedMsg{repo: p.Repo, prNumber: p.Number, state: state, merged: state == "MERGED", err: nil}
+	}
+}
+
+// checkMergeStateCmd is checkMergedCmd that also reports whether the PR is
+// behind its base.
+func checkMergeStateCmd(gh GitHub, p pr) tea.Cmd {
+	return func() tea.Msg {
+		current, err := gh.GetPR(p.Number)
+		if err != nil {
+			return checkMergedMsg{repo: p.Repo, prNumber: p.Number, err: err}
+		}
+		return checkMergedMsg{repo: p.Repo, prNumber: p.Number, state: current.State, mergeState: current.MergeState, merged: current.State == "MERGED"}
+	}
+}
+
+func updateBranchCmd(gh GitHub, p pr, rebase bool) tea.Cmd {
+	return func() tea.Msg {
+		err := gh.UpdateBranch(p.Number, rebase)
+		return updateBranchResultMsg{repo: p.Repo, prNumber: p.Number, err: err}
+	}
+}
+
+func setBaseCmd(gh GitHub, p pr, base string) tea.Cmd {
+	return func() tea.Msg {
+		return setBaseResultMsg{repo: p.Repo, prNumber: p.Number, err: gh.SetBase(p.Number, base)}
+	}
+}
+
+// mergeGateCmd reads the checks of the PR and, with withReview, its review
+// decision.
+func mergeGateCmd(gh GitHub, p pr, withReview bool) tea.Cmd {
+	return func() tea.Msg {
+		msg := gateStatusMsg{repo: p.Repo, prNumber: p.Number}
+		msg.checks, msg.err = gh.CheckStatus(p.Number)
+		if msg.err == nil && withReview {
+			msg.review, msg.err = gh.ReviewDecision(p.Number)
+		}
+		return msg
+	}
+}
+
+// watchPRCmd refreshes the PR of a pending schedule.
+func watchPRCmd(gh GitHub, p pr) tea.Cmd {
+	return func() tea.Msg {
+		current, err := gh.GetPR(p.Number)
+		return prWatchedMsg{repo: p.Repo, prNumber: p.Number, pr: current, err: err}
+	}
+}
+
+// checkDependencyCmd checks whether dep, a dependency of p, has merged.
+func checkDependencyCmd(gh GitHub, p, dep pr) tea.Cmd {
+	check := checkMergedCmd(gh, dep)
+	return func() tea.Msg {
+		return dependencyCheckedMsg{repo: p.Repo, prNumber: p.Number, dep: check().(checkMergedMsg)}
+	}
+}
+
+// ---------- Pipeline ----------
+
+// scheduler runs the pipeline against pluggable side effects, so the whole
+// state machine can be driven offline (see fakeGitHub).
+type scheduler struct {
+	// github returns the backend for an "owner/name" repository.
+	github func(repo string) GitHub
+	// notify sends a notification to the configured notifiers; nil sends
+	// nothing.
+	notify func(n notification) error
+	// freeze blocks or shifts merges that fall due inside a freeze; nil
+	// allows any time.
+	freeze *freezePolicy
+	// checksTimeout is how long a due merge may wait for its checks.
+	checksTimeout time.Duration
+	// verifyTimeout is how long schedules without their own VerifyTimeout
+	// verify their merge.
+	verifyTimeout time.Duration
+	// retry says which failed steps are attempted again.
+	retry retryPolicy
+	// comments are the templates of the comments posted on PRs.
+	comments commentTemplates
+	// dryRun treats every schedule as a dry run, see dryRunGitHub.
+	dryRun bool
+	// logf reports what dry runs would have done; nil discards it.
+	logf func(format string, args ...any)
+	// user returns the login the scheduler runs as, for comments, or "" while
+	// it is not known; nil leaves it empty.
+	user func() string
+}
+
+// login returns the login the scheduler runs as, if known.
+func (e scheduler) login() string {
+	if e.user == nil {
+		return ""
+	}
+	return e.user()
+}
+
+// isDryRun reports whether s only pretends to change its PR.
+func (e scheduler) isDryRun(s scheduledMerge) bool {
+	return e.dryRun || s.DryRun
+}
+
+// githubFor returns the backend for the PR of s, which only pretends to
+// change it when s is a dry run.
+func (e scheduler) githubFor(s scheduledMerge) GitHub {
+	gh := e.github(s.PR.Repo)
+	if e.isDryRun(s) {
+		return dryRunGitHub{GitHub: gh, repo: s.PR.Repo, logf: e.logf}
+	}
+	return gh
+}
+
+func newScheduler(cfg config) (scheduler, error) {
+	freeze, err := cfg.freezePolicy()
+	if err != nil {
+		return scheduler{}, err
+	}
+	retry, err := newRetryPolicy(cfg.Retry)
+	if err != nil {
+		return scheduler{}, err
+	}
+	comments, err := newCommentTemplates(cfg.Comments)
+	if err != nil {
+		return scheduler{}, err
+	}
+	notifiers, err := newNotifiers(cfg.Notifications)
+	if err != nil {
+		return scheduler{}, err
+	}
+	return scheduler{
+		github:        cfg.newGitHub,
+		notify:        notifiers.send,
+		freeze:        freeze,
+		checksTimeout: cfg.Gate.timeout(),
+		verifyTimeout: cfg.verifyTimeout(),
+		retry:         retry,
+		comments:      comments,
+	}, nil
+}
+
+// resumeSchedule adjusts a schedule loaded from disk so it picks up where the
+// previous run stopped. Steps that were in flight when the process died are
+// either retried (idempotent ones) or skipped (ones that would post a second
+// comment on the PR). It returns the command to re-issue, if any.
+func (e scheduler) resumeSchedule(s *scheduledMerge, now time.Time) tea.Cmd {
+	if s.done() {
+		return nil
+	}
+	// Dependency checks that never reported back are re-issued on the next poll.
+	for i := range s.DependsOn {
+		s.DependsOn[i].Checking = false
+	}
+	s.HeadChecking = false
+	s.Watching = false
+	if s.Retargeted && s.ChecksCheckAt.IsZero() {
+		// The retarget never reported back; changing the base is idempotent.
+		s.Retargeted = false
+	}
+
+	switch s.State {
+	case stateVerifying:
+		if s.FailureReason != "" {
+			// The failure comment may already be on the PR; don't post it
+			// twice. Disabling auto-merge is idempotent, so do that again.
+			s.LastMessage = "Resumed, disabling auto-merge again (failure comment not re-posted)"
+			disable := disableAutoMergeCmd(e.githubFor(*s), s.PR)
+			return func() tea.Msg {
+				msg := disable().(disableAutoMergeResultMsg)
+				msg.resumed = true
+				return msg
+			}
+		}
+		// The merge check never reported back; run it again on the next tick.
+		s.transition(now, stateAwaitingMerge, "Resumed, checking the merge again")
+	case stateCommenting:
+		// The pre-merge comment was sent, so go straight to the merge.
+		s.Commented = true
+		s.transition(now, stateMerging, "Resumed, triggering auto-merge...")
+		return mergePRCmd(e.githubFor(*s), s.PR, s.MergeMethod, s.HeadSHA)
+	case stateMerging:
+		if s.RetryAt.IsZero() {
+			// The auto-merge request never reported back; enabling it is idempotent.
+			return mergePRCmd(e.githubFor(*s), s.PR, s.MergeMethod, s.HeadSHA)
+		}
+	}
+	return nil
+}
+
+// stepSchedules starts the next step of every active schedule that is due.
+func (e scheduler) stepSchedules(scheduled []scheduledMerge, now time.Time) []tea.Cmd {
+	var cmds []tea.Cmd
+	for i := range scheduled {
+		s := &scheduled[i]
+		// Send what happened since the last step, including to schedules
+		// that finished or were cancelled by a client. Dry runs only log it.
+		for _, event := range s.PendingEvents {
+			switch {
+			case e.isDryRun(*s):
+				if e.logf != nil {
+					e.logf("dry run: would notify %q about %s", event, s.PR.ref())
+				}
+			case e.notify != nil:
+				cmds = append(cmds, notifyCmd(e.notify, event, *s, now))
+			}
+		}
+		s.PendingEvents = nil
+		if s.done() {
+			continue
+		}
+		// A dependency that can no longer merge cancels the schedule.
+		if s.State == statePending {
+			if reason := dependencyFailure(scheduled, s); reason != "" {
+				cmds = append(cmds, e.cancelForDependency(s, reason, now))
+				continue
+			}
+		}
+		// Keep an eye on the PR until the merge starts.
+		if s.State == statePending && !s.Watching && now.After(s.WatchAt) {
+			s.Watching = true
+			s.WatchAt = now.Add(watchInterval)
+			cmds = append(cmds, watchPRCmd(e.github(s.PR.Repo), s.PR))
+		}
+		// First, post a comment before triggering auto-merge.
+		if s.State == statePending && !s.When.IsZero() && now.After(s.When) {
+			// Wait until every dependency has merged.
+			if !s.dependenciesMerged() {
+				poll := now.After(s.DependencyCheckAt)
+				if poll {
+					s.DependencyCheckAt = now.Add(dependencyPollInterval)
+				}
+				var waiting []string
+				for i := range s.DependsOn {
+					d := &s.DependsOn[i]
+					if d.Merged {
+						continue
+					}
+					waiting = append(waiting, d.PR.ref())
+					if poll && !d.Checking {
+						d.Checking = true
+						cmds = append(cmds, checkDependencyCmd(e.github(d.PR.Repo), s.PR, d.PR))
+					}
+				}
+				s.LastMessage = "Waiting for " + strings.Join(waiting, ", ") + " to merge"
+				continue
+			}
+			// The freeze may have changed since the merge was scheduled.
+			when, message, err := e.freeze.check(now)
+			if err != nil {
+				s.fail(now, "Refused: "+err.Error())
+				continue
+			}
+			if message != "" {
+				s.moveTo(when)
+				s.LastMessage = message
+				continue
+			}
+			// A stacked PR still points at the merged branch below it: move
+			// it onto the stack's base, then wait for its checks.
+			if s.RetargetTo != "" && !s.Retargeted {
+				s.Retargeted = true
+				s.LastMessage = "Retargeting onto " + s.RetargetTo
+				cmds = append(cmds, setBaseCmd(e.githubFor(*s), s.PR, s.RetargetTo))
+				continue
+			}
+			// Hold the merge until its checks passed (and, with the gate, it
+			// got approved), up to a deadline.
+			if (s.Gate || s.Retargeted) && !s.ChecksPassed {
+				if s.Retargeted && s.ChecksCheckAt.IsZero() {
+					continue // the retarget has not reported back yet
+				}
+				if s.ChecksDeadline.IsZero() {
+					s.ChecksDeadline = now.Add(e.checksTimeout)
+				}
+				if now.After(s.ChecksDeadline) {
+					status := s.ChecksStatus
+					if status == "" {
+						status = "the checks never reported"
+					}
+					s.fail(now, fmt.Sprintf("Gave up at %s: %s", s.ChecksDeadline.Format("2006-01-02 15:04"), status))
+					continue
+				}
+				if now.After(s.ChecksCheckAt) {
+					s.ChecksCheckAt = now.Add(checksPollInterval)
+					cmds = append(cmds, mergeGateCmd(e.githubFor(*s), s.PR, s.Gate))
+				}
+				continue
+			}
+			// Only merge the commit confirmed when scheduling: new commits
+			// hold the merge until someone re-confirms it.
+			if s.HeadSHA != "" && !s.HeadVerified {
+				if s.NewHeadSHA == "" && !s.HeadChecking && now.After(s.HeadCheckAt) {
+					s.HeadChecking = true
+					s.LastMessage = "Checking the head commit is still " + shortSHA(s.HeadSHA)
+					cmds = append(cmds, checkHeadCmd(e.githubFor(*s), s.PR))
+				}
+				continue
+			}
+			if s.Commented {
+				// Held up after the comment, e.g. by a push: don't post it twice.
+				if s.transition(now, stateMerging, "Pre-merge comment already posted, triggering auto-merge...") {
+					cmds = append(cmds, mergePRCmd(e.githubFor(*s), s.PR, s.MergeMethod, s.HeadSHA))
+				}
+				continue
+			}
+			if !s.transition(now, stateCommenting, fmt.Sprintf("Posting pre-merge comment for PR #%d", s.PR.Number)) {
+				continue
+			}
+			cmds = append(cmds, commentTemplateCmd(e.githubFor(*s), s.PR, e.comments.preMerge, newCommentData(*s, e.login()), true))
+		}
+		// Enabling auto-merge failed with a transient error: try again.
+		if s.State == stateMerging && !s.RetryAt.IsZero() && now.After(s.RetryAt) {
+			s.RetryAt = time.Time{}
+			s.LastMessage = fmt.Sprintf("Retrying auto-merge (attempt %d/%d)", s.Retries+1, e.retry.maxAttempts)
+			cmds = append(cmds, mergePRCmd(e.githubFor(*s), s.PR, s.MergeMethod, s.HeadSHA))
+			continue
+		}
+		// After we have a CheckAt time and it's passed, schedule a check.
+		if s.State == stateAwaitingMerge && !s.CheckAt.IsZero() && now.After(s.CheckAt) {
+			if !s.transition(now, stateVerifying, fmt.Sprintf("Checking merge status for PR #%d", s.PR.Number)) {
+				continue
+			}
+			if s.UpdateBranch != "" {
+				cmds = append(cmds, checkMergeStateCmd(e.githubFor(*s), s.PR))
+			} else {
+				cmds = append(cmds, checkMergedCmd(e.githubFor(*s), s.PR))
+			}
+		}
+	}
+	return cmds
+}
+
+// verifyTimeoutOf returns how long s verifies its merge.
+func (e scheduler) verifyTimeoutOf(s *scheduledMerge) time.Duration {
+	if s.VerifyTimeout > 0 {
+		return s.VerifyTimeout
+	}
+	return e.verifyTimeout
+}
+
+// applyWatch updates a pending schedule from a refresh of its PR.
+func (e scheduler) applyWatch(s *scheduledMerge, p pr, now time.Time) {
+	switch p.State {
+	case "MERGED":
+		// Dependent schedules can go ahead.
+		s.MergedOutside = true
+		s.cancel(now, "Cancelled: PR was merged outside the scheduler")
+		return
+	case "CLOSED":
+		s.cancel(now, "Cancelled: PR was closed")
+		return
+	}
+	p.Repo = s.PR.Repo
+	s.PR = p
+
+	if s.HeadSHA != "" && p.HeadSHA != "" {
+		switch {
+		case p.HeadSHA != s.HeadSHA && p.HeadSHA != s.NewHeadSHA:
+			s.NewHeadSHA = p.HeadSHA
+			s.HeadVerified = false
+			s.record(now, fmt.Sprintf("Head moved from %s to %s", shortSHA(s.HeadSHA), shortSHA(p.HeadSHA)))
+			s.LastMessage = fmt.Sprintf("New commits since scheduling (%s -> %s), re-confirm to merge", shortSHA(s.HeadSHA), shortSHA(p.HeadSHA))
+		case p.HeadSHA == s.HeadSHA && s.NewHeadSHA != "":
+			// The new commits were force-pushed away again.
+			s.NewHeadSHA = ""
+			s.record(now, "Head back at "+shortSHA(s.HeadSHA))
+			s.LastMessage = "Head back at the confirmed commit " + shortSHA(s.HeadSHA)
+		}
+	}
+
+	var warnings []string
+	if p.Draft {
+		warnings = append(warnings, "PR is a draft")
+	}
+	if p.MergeState == "DIRTY" {
+		warnings = append(warnings, "PR has merge conflicts")
+	}
+	warning := strings.Join(warnings, " and ")
+	if warning == s.Warning {
+		return
+	}
+	if warning != "" {
+		s.record(now, warning)
+		s.LastMessage = warning + "; it cannot merge until that is fixed"
+	} else {
+		s.record(now, "No longer a draft or conflicting")
+		s.LastMessage = "PR can be merged again"
+	}
+	s.Warning = warning
+}
+
+// cancelForDependency cancels s because one of its dependencies will not
+// merge, and explains why on the PR.
+func (e scheduler) cancelForDependency(s *scheduledMerge, reason string, now time.Time) tea.Cmd {
+	s.cancel(now, "Cancelled: dependency "+reason)
+	comment := fmt.Sprintf("Scheduled auto-merge cancelled because dependency %s.", reason)
+	return commentPRCmd(e.githubFor(*s), s.PR, comment, false)
+}
+
+// applyResult folds the outcome of a command back into the schedules and
+// returns the follow-up commands.
+func (e scheduler) applyResult(scheduled []scheduledMerge, msg tea.Msg, now time.Time) []tea.Cmd {
+	switch msg := msg.(type) {
+
+	case mergeResultMsg:
+		idx := findScheduled(scheduled, msg.repo, msg.prNumber)
+		if idx < 0 && msg.err == nil {
+			// Cancelled while the call was in flight: whoever cancelled may
+			// have disabled auto-merge before it got set.
+			if i := findCancelledWhileMerging(scheduled, msg.repo, msg.prNumber); i >= 0 {
+				s := &scheduled[i]
+				s.record(now, "Auto-merge was set after the cancel, disabling it again")
+				return []tea.Cmd{disableAutoMergeCmd(e.githubFor(*s), s.PR)}
+			}
+		}
+		if idx >= 0 && scheduled[idx].State == stateMerging {
+			s := &scheduled[idx]
+			if msg.err != nil && s.HeadSHA != "" && headMoved(msg.err) {
+				// Pushed to after the head was checked: hold the merge until
+				// the new commits are re-confirmed, like any other push.
+				s.Retries = 0
+				s.RetryAt = time.Time{}
+				s.HeadVerified = false
+				s.transition(now, statePending, fmt.Sprintf("Head moved off %s before auto-merge was set, re-confirm to merge", shortSHA(s.HeadSHA)))
+			} else if msg.err != nil {
+				attempt := s.Retries + 1
+				s.record(now, fmt.Sprintf("Enabling auto-merge failed (attempt %d): %v", attempt, msg.err))
+				if delay, ok := e.retry.next(attempt, msg.err); ok {
+					s.Retries = attempt
+					s.RetryAt = now.Add(delay)
+					s.LastMessage = fmt.Sprintf("Auto-merge failed, retrying at %s: %v", s.RetryAt.Format("15:04:05"), msg.err)
+				} else {
+					s.fail(now, fmt.Sprintf("Auto-merge failed after %d attempts: %v", attempt, msg.err))
+				}
+			} else if e.isDryRun(*s) {
+				// Nothing was set on GitHub, so there is no merge to verify.
+				s.Retries = 0
+				s.merged(now, "Dry run: auto-merge would have been set, treated as merged")
+			} else {
+				attempt := s.Retries + 1
+				s.Retries = 0
+				// Auto-merge set; verify it until the deadline, CI may take a while.
+				s.VerifyDeadline = now.Add(e.verifyTimeoutOf(s))
+				s.CheckAt = now.Add(firstVerifyDelay)
+				if s.UpdateBranch != "" {
+					// Find out right away whether the branch is behind.
+					s.CheckAt = now
+				}
+				s.transition(now, stateAwaitingMerge, fmt.Sprintf("Auto-merge set (attempt %d), verifying until %s", attempt, s.VerifyDeadline.Format("15:04")))
+			}
+		}
+
+	case checkMergedMsg:
+		idx := findScheduled(scheduled, msg.repo, msg.prNumber)
+		if idx >= 0 && scheduled[idx].State == stateVerifying {
+			s := &scheduled[idx]
+			s.CheckAttempts++
+			switch {
+			case msg.merged:
+				s.merged(now, "PR is merged")
+			case msg.mergeState == "BEHIND" && s.BranchUpdates < maxBranchUpdates:
+				// Auto-merge cannot complete until the branch is up to date.
+				s.BranchUpdates++
+				s.LastMessage = fmt.Sprintf("Branch is behind %s, updating it (%s)", s.PR.BaseRef, s.UpdateBranch)
+				return []tea.Cmd{updateBranchCmd(e.githubFor(*s), s.PR, s.UpdateBranch == "rebase")}
+			case msg.err != nil:
+				attempt := s.Retries + 1
+				if delay, ok := e.retry.next(attempt, msg.err); ok {
+					s.Retries = attempt
+					s.CheckAt = now.Add(delay)
+					s.transition(now, stateAwaitingMerge, fmt.Sprintf("Merge check failed (attempt %d), retrying at %s: %v", attempt, s.CheckAt.Format("15:04:05"), msg.err))
+					return nil
+				}
+				s.record(now, fmt.Sprintf("Merge check failed (attempt %d): %v", attempt, msg.err))
+				// Out of retries: report the failure on the PR.
+				s.FailureReason = fmt.Sprintf("checking the merge failed %d times: %v", attempt, msg.err)
+				s.LastMessage = fmt.Sprintf("Merge check failed after %d attempts, fetching commit SHA...", attempt)
+				return []tea.Cmd{getCommitSHACmd(e.githubFor(*s), s.PR)}
+			case now.Before(s.VerifyDeadline) && msg.state != "CLOSED":
+				// Not merged yet: check again later.
+				s.Retries = 0
+				s.CheckAt = s.nextVerifyCheck(now)
+				s.transition(now, stateAwaitingMerge, fmt.Sprintf("Not merged yet after %d checks, next at %s", s.CheckAttempts, s.CheckAt.Format("15:04")))
+			default:
+				// PR is not merged - get commit SHA to include in failure comment
+				if msg.state == "CLOSED" {
+					s.FailureReason = "the PR was closed"
+				} else {
+					s.FailureReason = fmt.Sprintf("still not merged at %s after %d checks", now.Format("2006-01-02 15:04"), s.CheckAttempts)
+				}
+				s.LastMessage = fmt.Sprintf("PR not merged after %d checks, fetching commit SHA...", s.CheckAttempts)
+				return []tea.Cmd{getCommitSHACmd(e.githubFor(*s), s.PR)}
+			}
+		}
+
+	case commitSHAMsg:
+		idx := findScheduled(scheduled, msg.repo, msg.prNumber)
+		if idx >= 0 && scheduled[idx].State == stateVerifying {
+			s := &scheduled[idx]
+			sha := msg.sha
+			if msg.err != nil {
+				sha = "unknown"
+			}
+			// Disable auto-merge and post failure comment
+			s.LastMessage = "Disabling auto-merge and posting failure comment..."
+
+			data := newCommentData(*s, e.login())
+			data.HeadSHA = sha
+
+			gh := e.githubFor(*s)
+			return []tea.Cmd{
+				disableAutoMergeCmd(gh, s.PR),
+				commentTemplateCmd(gh, s.PR, e.comments.failure, data, false),
+			}
+		}
+
+	case commentResultMsg:
+		idx := findScheduled(scheduled, msg.repo, msg.prNumber)
+		if idx >= 0 {
+			if msg.isPreMerge {
+				// Pre-merge comment posted, now trigger auto-merge
+				message := "Pre-merge comment posted, triggering auto-merge..."
+				if msg.err != nil {
+					message = "Comment failed: " + msg.err.Error() + " (continuing with merge)"
+				} else if msg.skipped {
+					message = "Triggering auto-merge..."
+				}
+				if !scheduled[idx].transition(now, stateMerging, message) {
+					return nil
+				}
+				scheduled[idx].Commented = msg.err == nil && !msg.skipped
+				return []tea.Cmd{mergePRCmd(e.githubFor(scheduled[idx]), scheduled[idx].PR, scheduled[idx].MergeMethod, scheduled[idx].HeadSHA)}
+			}
+			// Failure comment posted - mark as done
+			if scheduled[idx].State != stateVerifying || scheduled[idx].FailureReason == "" {
+				return nil
+			}
+			if msg.err != nil {
+				scheduled[idx].fail(now, "PR not merged (failure comment failed: "+msg.err.Error()+")")
+			} else if msg.skipped {
+				scheduled[idx].fail(now, "PR not merged (auto-merge disabled, no comment)")
+			} else {
+				scheduled[idx].fail(now, "PR not merged (auto-merge disabled, failure comment posted)")
+			}
+		}
+
+	case updateBranchResultMsg:
+		idx := findScheduled(scheduled, msg.repo, msg.prNumber)
+		if idx >= 0 && scheduled[idx].State == stateVerifying {
+			s := &scheduled[idx]
+			if msg.err != nil {
+				// Keep verifying; the next check may find the branch updated
+				// by someone else, or try again.
+				s.CheckAt = s.nextVerifyCheck(now)
+				s.transition(now, stateAwaitingMerge, "Failed to update branch: "+msg.err.Error())
+			} else {
+				// A new CI run starts: verify it from scratch.
+				s.CheckAttempts = 0
+				s.VerifyDeadline = now.Add(e.verifyTimeoutOf(s))
+				s.CheckAt = now.Add(firstVerifyDelay)
+				s.transition(now, stateAwaitingMerge, "Branch updated, waiting for the new CI run until "+s.VerifyDeadline.Format("15:04"))
+			}
+		}
+
+	case setBaseResultMsg:
+		idx := findScheduled(scheduled, msg.repo, msg.prNumber)
+		if idx >= 0 {
+			s := &scheduled[idx]
+			if msg.err != nil {
+				s.fail(now, fmt.Sprintf("Retargeting onto %s failed: %v", s.RetargetTo, msg.err))
+			} else {
+				// Give the checks a moment to start before polling them.
+				s.ChecksCheckAt = now.Add(checksPollInterval)
+				s.LastMessage = "Retargeted onto " + s.RetargetTo + ", waiting for checks"
+			}
+		}
+
+	case gateStatusMsg:
+		idx := findScheduled(scheduled, msg.repo, msg.prNumber)
+		if idx >= 0 {
+			s := &scheduled[idx]
+			switch {
+			case msg.err != nil:
+				// Try again on the next poll.
+				s.ChecksStatus = "failed to get checks: " + msg.err.Error()
+				s.LastMessage = "Failed to get checks: " + msg.err.Error()
+			case msg.checks.State == "FAILURE":
+				s.fail(now, "Checks failed: "+strings.Join(msg.checks.Failing, ", "))
+			case msg.review == "CHANGES_REQUESTED":
+				s.fail(now, "Changes requested in review")
+			case msg.checks.State == "PENDING":
+				s.ChecksStatus = "still waiting for checks: " + strings.Join(msg.checks.Pending, ", ")
+				s.LastMessage = "Waiting for checks: " + strings.Join(msg.checks.Pending, ", ")
+			case msg.review == "REVIEW_REQUIRED":
+				s.ChecksStatus = "still waiting for an approving review"
+				s.LastMessage = "Waiting for an approving review"
+			default:
+				s.ChecksPassed = true
+				s.ChecksStatus = ""
+				s.LastMessage = "Checks passed"
+				if msg.review == "APPROVED" {
+					s.LastMessage = "Checks passed and PR approved"
+				}
+			}
+		}
+
+	case dependencyCheckedMsg:
+		idx := findScheduled(scheduled, msg.repo, msg.prNumber)
+		if idx >= 0 {
+			s := &scheduled[idx]
+			for i := range s.DependsOn {
+				d := &s.DependsOn[i]
+				if d.PR.Repo != msg.dep.repo || d.PR.Number != msg.dep.prNumber {
+					continue
+				}
+				d.Checking = false
+				switch {
+				case msg.dep.err != nil:
+					// Try again on the next poll.
+					s.LastMessage = fmt.Sprintf("Failed to check dependency %s: %v", d.PR.ref(), msg.dep.err)
+				case msg.dep.merged:
+					d.Merged = true
+				case msg.dep.state == "CLOSED":
+					return []tea.Cmd{e.cancelForDependency(s, d.PR.ref()+" was closed without merging", now)}
+				}
+			}
+		}
+
+	case notifyResultMsg:
+		if msg.err != nil {
+			// The schedule may have finished meanwhile; report on the latest.
+			for i := len(scheduled) - 1; i >= 0; i-- {
+				if s := &scheduled[i]; s.PR.Repo == msg.repo && s.PR.Number == msg.prNumber {
+					s.record(now, fmt.Sprintf("Notification %q failed: %v", msg.event, msg.err))
+					break
+				}
+			}
+		}
+
+	case prWatchedMsg:
+		idx := findScheduled(scheduled, msg.repo, msg.prNumber)
+		if idx >= 0 {
+			s := &scheduled[idx]
+			s.Watching = false
+			// A failed refresh is retried on the next one; once the merge
+			// started, its own checks take over.
+			if msg.err != nil || s.State != statePending {
+				return nil
+			}
+			e.applyWatch(s, msg.pr, now)
+		}
+
+	case headCheckedMsg:
+		idx := findScheduled(scheduled, msg.repo, msg.prNumber)
+		if idx >= 0 {
+			s := &scheduled[idx]
+			s.HeadChecking = false
+			switch {
+			case msg.err != nil:
+				attempt := s.Retries + 1
+				s.record(now, fmt.Sprintf("Head commit check failed (attempt %d): %v", attempt, msg.err))
+				delay, ok := e.retry.next(attempt, msg.err)
+				if !ok {
+					s.fail(now, fmt.Sprintf("Could not check the head commit after %d attempts: %v", attempt, msg.err))
+					return nil
+				}
+				s.Retries = attempt
+				s.HeadCheckAt = now.Add(delay)
+				s.LastMessage = fmt.Sprintf("Head commit check failed, retrying at %s: %v", s.HeadCheckAt.Format("15:04:05"), msg.err)
+			case msg.sha != s.HeadSHA:
+				s.Retries = 0
+				s.NewHeadSHA = msg.sha
+				s.record(now, fmt.Sprintf("Head moved from %s to %s", shortSHA(s.HeadSHA), shortSHA(msg.sha)))
+				s.LastMessage = fmt.Sprintf("New commits since scheduling (%s -> %s), re-confirm to merge", shortSHA(s.HeadSHA), shortSHA(msg.sha))
+			default:
+				s.Retries = 0
+				s.HeadVerified = true
+			}
+		}
+
+	case disableAutoMergeResultMsg:
+		idx := findScheduled(scheduled, msg.repo, msg.prNumber)
+		if idx >= 0 && msg.resumed {
+			s := &scheduled[idx]
+			if s.State != stateVerifying || s.FailureReason == "" {
+				return nil
+			}
+			if msg.err != nil {
+				s.fail(now, "PR not merged (failed to disable auto-merge after a restart: "+msg.err.Error()+")")
+			} else {
+				s.fail(now, "PR not merged (auto-merge disabled after a restart)")
+			}
+		} else if idx >= 0 {
+			if msg.err != nil {
+				// Log the error but don't fail - the comment is more important
+				scheduled[idx].LastMessage = "Failed to disable auto-merge: " + msg.err.Error()
+			}
+			// Don't mark as done here - wait for the comment result
+		} else if msg.err != nil {
+			if i := findCancelledWhileMerging(scheduled, msg.repo, msg.prNumber); i >= 0 {
+				scheduled[i].record(now, "Failed to disable auto-merge: "+msg.err.Error())
+			}
+		}
+	}
+	return nil
+}
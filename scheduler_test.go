@@ -0,0 +1,862 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// testStart is when every test begins: a Wednesday morning.
+var testStart = time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC)
+
+const testRepo = "acme/app"
+
+func testPR(number int) pr {
+	return pr{Repo: testRepo, Number: number, Title: "Change", Author: "bob", State: "OPEN", BaseRef: "main"}
+}
+
+// harness drives a scheduler against a fakeGitHub the way the daemon does,
+// on a fake clock, running every command right away.
+type harness struct {
+	t         *testing.T
+	gh        *fakeGitHub
+	e         scheduler
+	now       time.Time
+	scheduled []scheduledMerge
+	events    []string // notifications sent, e.g. "merged #1"
+}
+
+func newHarness(t *testing.T, prs ...pr) *harness {
+	t.Helper()
+	// The audit log is written to the state directory.
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	retry, err := newRetryPolicy(retryConfig{Backoff: "10s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	comments, err := newCommentTemplates(commentsConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &harness{t: t, gh: newFakeGitHub("alice", testRepo, prs...), now: testStart}
+	h.e = scheduler{
+		github: func(string) GitHub { return h.gh },
+		notify: func(n notification) error {
+			h.events = append(h.events, n.Event+" "+strings.TrimPrefix(n.PR.ref(), testRepo))
+			return nil
+		},
+		checksTimeout: time.Hour,
+		verifyTimeout: time.Hour,
+		retry:         retry,
+		comments:      comments,
+	}
+	return h
+}
+
+// add schedules s like addSchedule does.
+func (h *harness) add(s scheduledMerge) {
+	s.transition(h.now, statePending, "Scheduled")
+	s.notify(eventScheduled)
+	h.scheduled = append(h.scheduled, s)
+}
+
+// run runs cmds and the follow-ups of their results.
+func (h *harness) run(cmds ...tea.Cmd) {
+	for len(cmds) > 0 {
+		cmd := cmds[0]
+		cmds = cmds[1:]
+		if cmd != nil {
+			cmds = append(cmds, h.e.applyResult(h.scheduled, cmd(), h.now)...)
+		}
+	}
+}
+
+// advance moves the clock forward by d, stepping the schedules every second.
+func (h *harness) advance(d time.Duration) {
+	for end := h.now.Add(d); h.now.Before(end); {
+		h.now = h.now.Add(time.Second)
+		h.run(h.e.stepSchedules(h.scheduled, h.now)...)
+	}
+}
+
+// schedule returns the latest schedule of PR number.
+func (h *harness) schedule(number int) scheduledMerge {
+	h.t.Helper()
+	for i := len(h.scheduled) - 1; i >= 0; i-- {
+		if s := h.scheduled[i]; s.PR.Number == number {
+			return s
+		}
+	}
+	h.t.Fatalf("PR #%d has no schedule", number)
+	return scheduledMerge{}
+}
+
+func (h *harness) expectState(number int, want scheduleState) {
+	h.t.Helper()
+	if s := h.schedule(number); s.State != want {
+		h.t.Fatalf("PR #%d is %s, want %s (%s)", number, s.State, want, s.LastMessage)
+	}
+}
+
+// count returns how often call, e.g. "EnableAutoMerge #1", was made.
+func (h *harness) count(call string) int {
+	n := 0
+	for _, c := range h.gh.calls {
+		if c == call {
+			n++
+		}
+	}
+	return n
+}
+
+func TestPipeline(t *testing.T) {
+	tests := []struct {
+		name string
+		// setup adjusts the schedule of #1, due in a minute.
+		setup func(h *harness, s *scheduledMerge)
+		// script runs once it is scheduled.
+		script       func(h *harness)
+		wantState    scheduleState
+		wantMessage  string // part of the final LastMessage
+		wantEvents   []string
+		wantCalls    map[string]int
+		wantComments int
+	}{
+		{
+			name: "merges",
+			script: func(h *harness) {
+				h.advance(2 * time.Minute)
+				h.expectState(1, stateAwaitingMerge)
+				h.gh.setState(1, "MERGED")
+				h.advance(2 * time.Minute)
+			},
+			wantState:    stateMerged,
+			wantMessage:  "PR is merged",
+			wantEvents:   []string{"scheduled #1", "merged #1"},
+			wantCalls:    map[string]int{"EnableAutoMerge #1": 1, "DisableAutoMerge #1": 0},
+			wantComments: 1,
+		},
+		{
+			name: "merges right away",
+			script: func(h *harness) {
+				h.gh.mergeOnAutoMerge = true
+				h.advance(3 * time.Minute)
+			},
+			wantState:   stateMerged,
+			wantMessage: "PR is merged",
+		},
+		{
+			name: "retries a transient failure",
+			script: func(h *harness) {
+				h.gh.failNext("EnableAutoMerge", errors.New("dial tcp: connection refused"))
+				h.advance(2 * time.Minute)
+				h.gh.setState(1, "MERGED")
+				h.advance(2 * time.Minute)
+			},
+			wantState:   stateMerged,
+			wantMessage: "PR is merged",
+			wantEvents:  []string{"scheduled #1", "merged #1"},
+			wantCalls:   map[string]int{"EnableAutoMerge #1": 2},
+		},
+		{
+			name: "fails when auto-merge cannot be enabled",
+			script: func(h *harness) {
+				h.gh.failNext("EnableAutoMerge", errors.New("HTTP 422: Pull request is in clean status"))
+				h.advance(10 * time.Minute)
+			},
+			wantState:    stateFailed,
+			wantMessage:  "Auto-merge failed after 1 attempts: HTTP 422",
+			wantEvents:   []string{"scheduled #1", "failed #1"},
+			wantCalls:    map[string]int{"EnableAutoMerge #1": 1, "PRState #1": 0},
+			wantComments: 1,
+		},
+		{
+			name: "continues when the pre-merge comment fails",
+			script: func(h *harness) {
+				h.gh.failNext("Comment", errors.New("HTTP 502: Bad Gateway"))
+				h.advance(2 * time.Minute)
+				h.gh.setState(1, "MERGED")
+				h.advance(2 * time.Minute)
+			},
+			wantState:   stateMerged,
+			wantMessage: "PR is merged",
+			wantCalls:   map[string]int{"EnableAutoMerge #1": 1},
+		},
+		{
+			name: "retries a failed merge check",
+			script: func(h *harness) {
+				h.advance(2 * time.Minute)
+				h.gh.failNext("PRState", errors.New("HTTP 502: Bad Gateway"))
+				h.advance(time.Minute)
+				h.gh.setState(1, "MERGED")
+				h.advance(5 * time.Minute)
+			},
+			wantState:   stateMerged,
+			wantMessage: "PR is merged",
+			wantCalls:   map[string]int{"DisableAutoMerge #1": 0},
+		},
+		{
+			name: "reports a merge that did not happen",
+			script: func(h *harness) {
+				h.advance(2 * time.Hour)
+			},
+			wantState:    stateFailed,
+			wantMessage:  "failure comment posted",
+			wantEvents:   []string{"scheduled #1", "failed #1"},
+			wantCalls:    map[string]int{"EnableAutoMerge #1": 1, "DisableAutoMerge #1": 1},
+			wantComments: 2,
+		},
+		{
+			name:  "verifies for the schedule's own timeout",
+			setup: func(h *harness, s *scheduledMerge) { s.VerifyTimeout = 10 * time.Minute },
+			script: func(h *harness) {
+				h.advance(10 * time.Minute)
+				h.expectState(1, stateAwaitingMerge)
+				h.advance(5 * time.Minute)
+			},
+			wantState:   stateFailed,
+			wantMessage: "auto-merge disabled",
+			wantEvents:  []string{"scheduled #1", "failed #1"},
+		},
+		{
+			name: "reports a PR closed while verifying",
+			script: func(h *harness) {
+				h.advance(2 * time.Minute)
+				h.gh.setState(1, "CLOSED")
+				h.advance(5 * time.Minute)
+			},
+			wantState:    stateFailed,
+			wantEvents:   []string{"scheduled #1", "failed #1"},
+			wantCalls:    map[string]int{"DisableAutoMerge #1": 1},
+			wantComments: 2,
+		},
+		{
+			name: "reports a failed failure comment",
+			script: func(h *harness) {
+				h.advance(90 * time.Second)
+				h.gh.failNext("Comment", errors.New("HTTP 502: Bad Gateway"))
+				h.advance(2 * time.Hour)
+			},
+			wantState:    stateFailed,
+			wantMessage:  "failure comment failed",
+			wantEvents:   []string{"scheduled #1", "failed #1"},
+			wantComments: 1,
+		},
+		{
+			name: "updates a branch that is behind",
+			setup: func(h *harness, s *scheduledMerge) {
+				s.UpdateBranch = "rebase"
+				h.gh.setMergeState(1, "BEHIND")
+			},
+			script: func(h *harness) {
+				h.advance(2 * time.Minute)
+				if s := h.scheduled[0]; s.BranchUpdates != 1 {
+					h.t.Fatalf("%d branch updates, want 1 (%s)", s.BranchUpdates, s.LastMessage)
+				}
+				h.gh.setState(1, "MERGED")
+				h.advance(2 * time.Minute)
+			},
+			wantState:   stateMerged,
+			wantMessage: "PR is merged",
+			wantCalls:   map[string]int{"UpdateBranch #1": 1},
+		},
+		{
+			name:  "merges the head confirmed when scheduling",
+			setup: func(h *harness, s *scheduledMerge) { s.HeadSHA = "sha-1" },
+			script: func(h *harness) {
+				h.advance(2 * time.Minute)
+				h.gh.setState(1, "MERGED")
+				h.advance(2 * time.Minute)
+			},
+			wantState:   stateMerged,
+			wantMessage: "PR is merged",
+			wantCalls:   map[string]int{"EnableAutoMerge #1": 1},
+		},
+		{
+			name: "holds a merge until the head is confirmed",
+			setup: func(h *harness, s *scheduledMerge) {
+				s.HeadSHA = "sha-1"
+				h.gh.setHeadSHA(1, "sha-2")
+			},
+			script: func(h *harness) {
+				h.advance(5 * time.Minute)
+				h.expectState(1, statePending)
+				if s := h.schedule(1); s.NewHeadSHA != "sha-2" {
+					h.t.Fatalf("NewHeadSHA = %q, want sha-2", s.NewHeadSHA)
+				}
+			},
+			wantState:   statePending,
+			wantMessage: "re-confirm to merge",
+			wantCalls:   map[string]int{"Comment #1": 0, "EnableAutoMerge #1": 0},
+		},
+		{
+			name: "cancels when the PR is closed",
+			script: func(h *harness) {
+				h.gh.setState(1, "CLOSED")
+				h.advance(5 * time.Minute)
+			},
+			wantState:   stateCancelled,
+			wantMessage: "Cancelled: PR was closed",
+			wantEvents:  []string{"scheduled #1", "cancelled #1"},
+			wantCalls:   map[string]int{"EnableAutoMerge #1": 0},
+		},
+		{
+			name: "cancelled when the PR was merged by hand",
+			script: func(h *harness) {
+				h.gh.setState(1, "MERGED")
+				h.advance(5 * time.Minute)
+			},
+			wantState:   stateCancelled,
+			wantMessage: "Cancelled: PR was merged outside the scheduler",
+			wantEvents:  []string{"scheduled #1", "cancelled #1"},
+			wantCalls:   map[string]int{"EnableAutoMerge #1": 0},
+		},
+		{
+			name: "gate waits for checks and approval",
+			setup: func(h *harness, s *scheduledMerge) {
+				s.Gate = true
+				h.gh.setChecks(1, checksResult{State: "PENDING", Pending: []string{"ci"}})
+				h.gh.setReviewDecision(1, "REVIEW_REQUIRED")
+			},
+			script: func(h *harness) {
+				h.advance(5 * time.Minute)
+				h.expectState(1, statePending)
+				h.gh.setChecks(1, checksResult{State: "SUCCESS"})
+				h.advance(time.Minute)
+				h.expectState(1, statePending)
+				h.gh.setReviewDecision(1, "APPROVED")
+				h.advance(time.Minute)
+				h.expectState(1, stateAwaitingMerge)
+				h.gh.setState(1, "MERGED")
+				h.advance(2 * time.Minute)
+			},
+			wantState:   stateMerged,
+			wantMessage: "PR is merged",
+			wantCalls:   map[string]int{"EnableAutoMerge #1": 1},
+		},
+		{
+			name: "gate fails on failing checks",
+			setup: func(h *harness, s *scheduledMerge) {
+				s.Gate = true
+				h.gh.setChecks(1, checksResult{State: "FAILURE", Failing: []string{"lint"}})
+			},
+			script:      func(h *harness) { h.advance(2 * time.Minute) },
+			wantState:   stateFailed,
+			wantMessage: "Checks failed: lint",
+			wantEvents:  []string{"scheduled #1", "failed #1"},
+			wantCalls:   map[string]int{"Comment #1": 0},
+		},
+		{
+			name: "gate fails on requested changes",
+			setup: func(h *harness, s *scheduledMerge) {
+				s.Gate = true
+				h.gh.setReviewDecision(1, "CHANGES_REQUESTED")
+			},
+			script:      func(h *harness) { h.advance(2 * time.Minute) },
+			wantState:   stateFailed,
+			wantMessage: "Changes requested",
+		},
+		{
+			name: "gate gives up after its timeout",
+			setup: func(h *harness, s *scheduledMerge) {
+				s.Gate = true
+				h.gh.setChecks(1, checksResult{State: "PENDING", Pending: []string{"ci"}})
+			},
+			script:      func(h *harness) { h.advance(2 * time.Hour) },
+			wantState:   stateFailed,
+			wantMessage: "Gave up",
+			wantCalls:   map[string]int{"EnableAutoMerge #1": 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHarness(t, testPR(1))
+			s := scheduledMerge{PR: testPR(1), When: h.now.Add(time.Minute), MergeMethod: mergeMethodSquash}
+			if tt.setup != nil {
+				tt.setup(h, &s)
+			}
+			h.add(s)
+			tt.script(h)
+
+			got := h.scheduled[0]
+			if got.State != tt.wantState {
+				t.Errorf("state = %s, want %s (%s)", got.State, tt.wantState, got.LastMessage)
+			}
+			if !strings.Contains(got.LastMessage, tt.wantMessage) {
+				t.Errorf("last message = %q, want it to contain %q", got.LastMessage, tt.wantMessage)
+			}
+			if tt.wantEvents != nil && !slices.Equal(h.events, tt.wantEvents) {
+				t.Errorf("notifications = %v, want %v", h.events, tt.wantEvents)
+			}
+			for call, want := range tt.wantCalls {
+				if n := h.count(call); n != want {
+					t.Errorf("%s called %d times, want %d (calls: %v)", call, n, want, h.gh.calls)
+				}
+			}
+			if tt.wantComments != 0 {
+				if n := len(h.gh.comments(1)); n != tt.wantComments {
+					t.Errorf("%d comments posted, want %d: %q", n, tt.wantComments, h.gh.comments(1))
+				}
+			}
+			if p := h.gh.prs[1]; p.autoMerge && p.autoMergeMethod != mergeMethodSquash {
+				t.Errorf("auto-merge method = %s, want squash", p.autoMergeMethod)
+			}
+		})
+	}
+}
+
+func TestResumeSchedule(t *testing.T) {
+	tests := []struct {
+		name      string
+		setup     func(s *scheduledMerge)
+		wantState scheduleState
+		wantCalls map[string]int
+	}{
+		{
+			name:      "pending",
+			setup:     func(s *scheduledMerge) { s.State = statePending },
+			wantState: statePending,
+		},
+		{
+			name:      "posting the pre-merge comment",
+			setup:     func(s *scheduledMerge) { s.State = stateCommenting },
+			wantState: stateAwaitingMerge,
+			wantCalls: map[string]int{"Comment #1": 0, "EnableAutoMerge #1": 1},
+		},
+		{
+			name:      "enabling auto-merge",
+			setup:     func(s *scheduledMerge) { s.State = stateMerging },
+			wantState: stateAwaitingMerge,
+			wantCalls: map[string]int{"EnableAutoMerge #1": 1},
+		},
+		{
+			name: "waiting to retry auto-merge",
+			setup: func(s *scheduledMerge) {
+				s.State = stateMerging
+				s.RetryAt = testStart.Add(time.Minute)
+			},
+			wantState: stateMerging,
+			wantCalls: map[string]int{"EnableAutoMerge #1": 0},
+		},
+		{
+			name:      "awaiting the merge",
+			setup:     func(s *scheduledMerge) { s.State = stateAwaitingMerge },
+			wantState: stateAwaitingMerge,
+		},
+		{
+			name:      "checking the merge",
+			setup:     func(s *scheduledMerge) { s.State = stateVerifying },
+			wantState: stateAwaitingMerge,
+			wantCalls: map[string]int{"PRState #1": 0},
+		},
+		{
+			name: "reporting a failure",
+			setup: func(s *scheduledMerge) {
+				s.State = stateVerifying
+				s.FailureReason = "still not merged"
+			},
+			wantState: stateFailed,
+			wantCalls: map[string]int{"Comment #1": 0, "DisableAutoMerge #1": 1},
+		},
+		{
+			name:      "finished",
+			setup:     func(s *scheduledMerge) { s.State = stateMerged },
+			wantState: stateMerged,
+			wantCalls: map[string]int{"EnableAutoMerge #1": 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHarness(t, testPR(1))
+			h.gh.prs[1].autoMerge = true
+			s := scheduledMerge{PR: testPR(1), When: h.now.Add(-time.Minute)}
+			tt.setup(&s)
+			h.scheduled = append(h.scheduled, s)
+			h.run(h.e.resumeSchedule(&h.scheduled[0], h.now))
+
+			h.expectState(1, tt.wantState)
+			for call, want := range tt.wantCalls {
+				if n := h.count(call); n != want {
+					t.Errorf("%s called %d times, want %d (calls: %v)", call, n, want, h.gh.calls)
+				}
+			}
+			if tt.wantState == stateFailed && h.gh.prs[1].autoMerge {
+				t.Error("auto-merge is still enabled")
+			}
+		})
+	}
+}
+
+func TestDependencies(t *testing.T) {
+	tests := []struct {
+		name string
+		// schedules are scheduled in order, all due in a minute.
+		schedules func(prs []pr) []scheduledMerge
+		script    func(h *harness)
+		// want maps PRs to part of their final LastMessage.
+		want map[int]string
+	}{
+		{
+			name: "waits for its dependency",
+			schedules: func(prs []pr) []scheduledMerge {
+				return []scheduledMerge{{PR: prs[0]}, {PR: prs[1], DependsOn: []dependency{{PR: prs[0]}}}}
+			},
+			script: func(h *harness) {
+				h.advance(2 * time.Minute)
+				h.expectState(1, stateAwaitingMerge)
+				h.expectState(2, statePending)
+				h.gh.setState(1, "MERGED")
+				h.advance(time.Minute)
+				h.expectState(2, stateAwaitingMerge)
+				h.gh.setState(2, "MERGED")
+				h.advance(2 * time.Minute)
+			},
+			want: map[int]string{1: "PR is merged", 2: "PR is merged"},
+		},
+		{
+			name: "cancelled with its dependency",
+			schedules: func(prs []pr) []scheduledMerge {
+				return []scheduledMerge{{PR: prs[0]}, {PR: prs[1], DependsOn: []dependency{{PR: prs[0]}}}}
+			},
+			script: func(h *harness) {
+				h.scheduled[0].cancel(h.now, "Cancelled")
+				h.advance(2 * time.Minute)
+				if c := h.gh.comments(2); len(c) != 1 || !strings.Contains(c[0], "was cancelled") {
+					h.t.Errorf("comments on #2 = %q, want the cancellation explained", c)
+				}
+			},
+			want: map[int]string{1: "Cancelled", 2: "Cancelled: dependency acme/app#1 was cancelled"},
+		},
+		{
+			name: "goes ahead when its dependency is merged by hand",
+			schedules: func(prs []pr) []scheduledMerge {
+				return []scheduledMerge{{PR: prs[0]}, {PR: prs[1], DependsOn: []dependency{{PR: prs[0]}}}}
+			},
+			script: func(h *harness) {
+				h.gh.setState(1, "MERGED")
+				h.advance(2 * time.Minute)
+				h.expectState(1, stateCancelled)
+				h.expectState(2, stateAwaitingMerge)
+			},
+			want: map[int]string{1: "merged outside the scheduler", 2: "Auto-merge set"},
+		},
+		{
+			name: "cancelled when its dependency fails",
+			schedules: func(prs []pr) []scheduledMerge {
+				return []scheduledMerge{{PR: prs[0]}, {PR: prs[1], DependsOn: []dependency{{PR: prs[0]}}}}
+			},
+			script: func(h *harness) {
+				h.gh.failNext("EnableAutoMerge", errors.New("HTTP 422: Pull request is in clean status"))
+				h.advance(2 * time.Minute)
+			},
+			want: map[int]string{1: "Auto-merge failed", 2: "acme/app#1 failed to merge"},
+		},
+		{
+			name: "polls an unscheduled dependency",
+			schedules: func(prs []pr) []scheduledMerge {
+				return []scheduledMerge{{PR: prs[1], DependsOn: []dependency{{PR: prs[0]}}}}
+			},
+			script: func(h *harness) {
+				h.advance(2 * time.Minute)
+				h.expectState(2, statePending)
+				h.gh.setState(1, "MERGED")
+				h.advance(time.Minute)
+				h.expectState(2, stateAwaitingMerge)
+			},
+			want: map[int]string{2: "Auto-merge set"},
+		},
+		{
+			name: "cancelled when a dependency is closed",
+			schedules: func(prs []pr) []scheduledMerge {
+				return []scheduledMerge{{PR: prs[1], DependsOn: []dependency{{PR: prs[0]}}}}
+			},
+			script: func(h *harness) {
+				h.gh.setState(1, "CLOSED")
+				h.advance(2 * time.Minute)
+				h.expectState(2, stateCancelled)
+			},
+			want: map[int]string{2: "acme/app#1 was closed without merging"},
+		},
+		{
+			name: "merges a stack bottom-up",
+			schedules: func(prs []pr) []scheduledMerge {
+				return stackSchedules(stackOf(prs, prs[1]), time.Time{}, mergeMethodMerge)
+			},
+			script: func(h *harness) {
+				h.advance(2 * time.Minute)
+				h.expectState(2, statePending)
+				h.gh.setState(1, "MERGED")
+				h.advance(90 * time.Second)
+				if base := h.gh.prs[2].BaseRef; base != "main" {
+					h.t.Fatalf("#2 is based on %s, want it retargeted onto main", base)
+				}
+				h.expectState(2, stateAwaitingMerge)
+				h.gh.setState(2, "MERGED")
+				h.advance(2 * time.Minute)
+			},
+			want: map[int]string{1: "PR is merged", 2: "PR is merged"},
+		},
+		{
+			name: "stops a stack whose checks fail after retargeting",
+			schedules: func(prs []pr) []scheduledMerge {
+				return stackSchedules(stackOf(prs, prs[1]), time.Time{}, mergeMethodMerge)
+			},
+			script: func(h *harness) {
+				h.gh.setChecks(2, checksResult{State: "FAILURE", Failing: []string{"ci"}})
+				h.advance(2 * time.Minute)
+				h.gh.setState(1, "MERGED")
+				h.advance(2 * time.Minute)
+				h.expectState(2, stateFailed)
+			},
+			want: map[int]string{2: "Checks failed: ci"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bottom, top := testPR(1), testPR(2)
+			bottom.HeadRef = "feature"
+			top.BaseRef, top.HeadRef = "feature", "feature-2"
+			h := newHarness(t, bottom, top)
+			for _, s := range tt.schedules([]pr{bottom, top}) {
+				s.When = h.now.Add(time.Minute)
+				h.add(s)
+			}
+			tt.script(h)
+			for number, want := range tt.want {
+				if got := h.schedule(number).LastMessage; !strings.Contains(got, want) {
+					t.Errorf("PR #%d: last message = %q, want it to contain %q", number, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCancelSchedule(t *testing.T) {
+	h := newHarness(t, testPR(1), testPR(2))
+	// The state file only keeps what finished in the last day.
+	h.now = time.Now()
+	for _, number := range []int{1, 2} {
+		if err := addSchedule(scheduledMerge{PR: testPR(number), When: h.now.Add(time.Minute)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	scheduled, err := loadSchedules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.scheduled = scheduled
+
+	// #2 gets as far as enabling auto-merge; #1 is cancelled before that.
+	h.scheduled[0].When = h.now.Add(time.Hour)
+	h.advance(2 * time.Minute)
+	h.expectState(2, stateAwaitingMerge)
+	if err := saveSchedules(h.scheduled); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		number        int
+		wantAutoMerge bool
+	}{
+		{1, false},
+		{2, true},
+	} {
+		cancelled, found, err := cancelSchedule(testRepo, tt.number, h.now)
+		if err != nil || !found {
+			t.Fatalf("cancelSchedule(#%d) = %v, %v", tt.number, found, err)
+		}
+		if cancelled.autoMergeRequested() != tt.wantAutoMerge {
+			t.Errorf("#%d: autoMergeRequested() = %v, want %v", tt.number, !tt.wantAutoMerge, tt.wantAutoMerge)
+		}
+	}
+	if _, found, _ := cancelSchedule(testRepo, 1, h.now); found {
+		t.Error("cancelled #1 twice")
+	}
+
+	if h.scheduled, err = loadSchedules(); err != nil {
+		t.Fatal(err)
+	}
+	h.events = nil
+	calls := len(h.gh.calls)
+	h.advance(2 * time.Minute)
+	h.expectState(1, stateCancelled)
+	h.expectState(2, stateCancelled)
+	if want := []string{"cancelled #1", "cancelled #2"}; !slices.Equal(h.events, want) {
+		t.Errorf("notifications = %v, want %v", h.events, want)
+	}
+	if len(h.gh.calls) != calls {
+		t.Errorf("cancelled schedules kept calling GitHub: %v", h.gh.calls[calls:])
+	}
+}
+
+func TestGateAcrossFreezeShift(t *testing.T) {
+	h := newHarness(t, testPR(1))
+	freeze, err := newFreezePolicy(freezeConfig{BusinessHours: []businessHours{
+		{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "09:00", End: "17:00"},
+	}}, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.e.freeze = freeze
+	h.now = time.Date(2026, 10, 16, 16, 40, 0, 0, time.Local) // a Friday
+	h.gh.setChecks(1, checksResult{State: "PENDING", Pending: []string{"ci"}})
+	h.add(scheduledMerge{PR: testPR(1), When: h.now, Gate: true})
+
+	// Still waiting for the checks when business hours end.
+	h.advance(30 * time.Minute)
+	s := h.schedule(1)
+	if monday := time.Date(2026, 10, 19, 9, 0, 0, 0, time.Local); !s.When.Equal(monday) {
+		t.Fatalf("moved to %s, want %s", s.When, monday)
+	}
+	if !s.ChecksDeadline.IsZero() || s.ChecksStatus != "" {
+		t.Errorf("the gate kept its deadline %s (%q) across the move", s.ChecksDeadline, s.ChecksStatus)
+	}
+
+	h.now = s.When
+	h.advance(5 * time.Minute)
+	h.expectState(1, statePending)
+	h.gh.setChecks(1, checksResult{State: "SUCCESS"})
+	h.advance(time.Minute)
+	h.expectState(1, stateAwaitingMerge)
+
+	// Without checks ever passing, the give-up says what was pending.
+	h = newHarness(t, testPR(1))
+	h.gh.setChecks(1, checksResult{State: "PENDING", Pending: []string{"ci", "e2e"}})
+	h.add(scheduledMerge{PR: testPR(1), When: h.now, Gate: true})
+	h.advance(time.Minute)
+	h.scheduled[0].LastMessage = "Something unrelated"
+	h.advance(2 * time.Hour)
+	h.expectState(1, stateFailed)
+	if got, want := h.schedule(1).LastMessage, "still waiting for checks: ci, e2e"; !strings.HasSuffix(got, want) {
+		t.Errorf("gave up with %q, want it to end in %q", got, want)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	tests := []struct {
+		name      string
+		daemonDry bool // the daemon runs with --dry-run
+		dryRun    bool // the schedule is a dry run
+	}{
+		{name: "dry-run schedule", dryRun: true},
+		{name: "dry-run daemon", daemonDry: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHarness(t, testPR(1))
+			var logged []string
+			h.e.dryRun = tt.daemonDry
+			h.e.logf = func(format string, args ...any) { logged = append(logged, fmt.Sprintf(format, args...)) }
+			h.add(scheduledMerge{PR: testPR(1), When: h.now.Add(time.Minute), DryRun: tt.dryRun})
+			h.advance(2 * time.Minute)
+
+			h.expectState(1, stateMerged)
+			if len(h.events) != 0 {
+				t.Errorf("dry run sent notifications %v", h.events)
+			}
+			if n := len(h.gh.comments(1)); n != 0 || h.gh.prs[1].autoMerge {
+				t.Errorf("dry run changed the PR: %d comments, auto-merge %v", n, h.gh.prs[1].autoMerge)
+			}
+			for _, want := range []string{"would comment", "would enable auto-merge", `would notify "merged"`} {
+				if !slices.ContainsFunc(logged, func(l string) bool { return strings.Contains(l, want) }) {
+					t.Errorf("nothing logged like %q: %q", want, logged)
+				}
+			}
+		})
+	}
+
+	// A real schedule does not take a dry run's merge for a real one.
+	h := newHarness(t, testPR(1), testPR(2))
+	h.add(scheduledMerge{PR: testPR(1), When: h.now.Add(time.Minute), DryRun: true})
+	h.add(scheduledMerge{PR: testPR(2), When: h.now.Add(time.Minute), DependsOn: []dependency{{PR: testPR(1)}}})
+	h.advance(5 * time.Minute)
+	h.expectState(1, stateMerged)
+	h.expectState(2, statePending)
+}
+
+func TestHeadMovedWhileEnablingAutoMerge(t *testing.T) {
+	h := newHarness(t, testPR(1))
+	h.add(scheduledMerge{PR: testPR(1), When: h.now.Add(time.Minute), HeadSHA: "sha-1"})
+	// The push lands between the head check and enabling auto-merge.
+	h.gh.failNext("EnableAutoMerge", errors.New("GraphQL: Head branch was modified. Review and try the merge again. (enablePullRequestAutoMerge)"))
+	h.advance(61 * time.Second) // the head check
+	h.advance(time.Second)      // the comment and auto-merge
+	h.expectState(1, statePending)
+	h.gh.setHeadSHA(1, "sha-2")
+	h.advance(time.Minute)
+	h.expectState(1, statePending)
+	if s := h.schedule(1); s.NewHeadSHA != "sha-2" {
+		t.Fatalf("NewHeadSHA = %q, want sha-2 (%s)", s.NewHeadSHA, s.LastMessage)
+	}
+
+	// Re-confirmed, as confirmHead does.
+	s := &h.scheduled[0]
+	s.HeadSHA, s.NewHeadSHA = s.NewHeadSHA, ""
+	h.advance(2 * time.Minute)
+	h.expectState(1, stateAwaitingMerge)
+	if n := h.count("EnableAutoMerge #1"); n != 2 {
+		t.Errorf("EnableAutoMerge called %d times, want 2", n)
+	}
+	if n := len(h.gh.comments(1)); n != 1 {
+		t.Errorf("posted %d pre-merge comments, want 1", n)
+	}
+	if len(h.events) != 1 {
+		t.Errorf("notifications = %v, want only the scheduling", h.events)
+	}
+}
+
+// cancellingGitHub cancels a schedule as soon as auto-merge is enabled, before
+// the scheduler sees the result, like a cancel racing the call.
+type cancellingGitHub struct {
+	GitHub
+	cancel func()
+}
+
+func (g cancellingGitHub) EnableAutoMerge(number int, method mergeMethod, headSHA string) error {
+	err := g.GitHub.EnableAutoMerge(number, method, headSHA)
+	g.cancel()
+	return err
+}
+
+func TestCancelWhileEnablingAutoMerge(t *testing.T) {
+	h := newHarness(t, testPR(1))
+	h.e.github = func(string) GitHub {
+		return cancellingGitHub{GitHub: h.gh, cancel: func() {
+			cancelled := h.scheduled[0]
+			h.scheduled[0].cancel(h.now, "Cancelled")
+			if !cancelled.autoMergeRequested() {
+				t.Errorf("cancelled in %s, want it cancelled while merging", cancelled.State)
+			}
+		}}
+	}
+	h.add(scheduledMerge{PR: testPR(1), When: h.now.Add(time.Minute)})
+	h.advance(2 * time.Minute)
+
+	h.expectState(1, stateCancelled)
+	if h.gh.prs[1].autoMerge {
+		t.Error("auto-merge is still enabled")
+	}
+	if n := h.count("DisableAutoMerge #1"); n != 1 {
+		t.Errorf("DisableAutoMerge called %d times, want 1", n)
+	}
+	if want := []string{"scheduled #1", "cancelled #1"}; !slices.Equal(h.events, want) {
+		t.Errorf("notifications = %v, want %v", h.events, want)
+	}
+
+	// Auto-merge that failed to enable needs no disabling.
+	h = newHarness(t, testPR(1))
+	h.e.github = func(string) GitHub {
+		return cancellingGitHub{GitHub: h.gh, cancel: func() { h.scheduled[0].cancel(h.now, "Cancelled") }}
+	}
+	h.gh.failNext("EnableAutoMerge", errors.New("HTTP 502"))
+	h.add(scheduledMerge{PR: testPR(1), When: h.now.Add(time.Minute)})
+	h.advance(2 * time.Minute)
+	h.expectState(1, stateCancelled)
+	if n := h.count("DisableAutoMerge #1"); n != 0 {
+		t.Errorf("DisableAutoMerge called %d times, want 0", n)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import "time"
+
+// ---------- Stacked PRs ----------
+
+// PRs form a stack when one is based on another's branch: B's base branch
+// is A's head branch. Merging the stack bottom-up means merging A, then
+// retargeting B onto A's base, waiting for B's checks and merging B, and so
+// on up the stack.
+
+// stackParent returns the PR that p is stacked on, if it is in prs.
+func stackParent(prs []pr, p pr) (pr, bool) {
+	for _, other := range prs {
+		if other.Repo == p.Repo && other.Number != p.Number && other.HeadRef != "" && other.HeadRef == p.BaseRef {
+			return other, true
+		}
+	}
+	return pr{}, false
+}
+
+// stackChildren returns the PRs stacked directly on p.
+func stackChildren(prs []pr, p pr) []pr {
+	var children []pr
+	for _, other := range prs {
+		if other.Repo == p.Repo && other.Number != p.Number && p.HeadRef != "" && other.BaseRef == p.HeadRef {
+			children = append(children, other)
+		}
+	}
+	return children
+}
+
+// stackRoot walks down from p to the bottom of its stack. In a cycle of PRs
+// based on each other it stops before coming round to one it already saw.
+func stackRoot(prs []pr, p pr) pr {
+	seen := map[string]bool{p.ref(): true}
+	for {
+		parent, ok := stackParent(prs, p)
+		if !ok || seen[parent.ref()] {
+			return p
+		}
+		seen[parent.ref()] = true
+		p = parent
+	}
+}
+
+// stackOf returns the whole stack containing p, bottom-up: its root first,
+// then every PR after the one it is based on.
+func stackOf(prs []pr, p pr) []pr {
+	root := stackRoot(prs, p)
+	stack := []pr{root}
+	seen := map[string]bool{root.ref(): true}
+	for i := 0; i < len(stack); i++ {
+		for _, child := range stackChildren(prs, stack[i]) {
+			if !seen[child.ref()] {
+				seen[child.ref()] = true
+				stack = append(stack, child)
+			}
+		}
+	}
+	return stack
+}
+
+// stackTree orders prs so every stack is listed as a tree under its root,
+// returning the depth of each PR in the tree. Unstacked PRs keep their order.
+func stackTree(prs []pr) (ordered []pr, depths []int) {
+	seen := make(map[string]bool, len(prs))
+	var walk func(p pr, depth int)
+	walk = func(p pr, depth int) {
+		if seen[p.ref()] {
+			return
+		}
+		seen[p.ref()] = true
+		ordered = append(ordered, p)
+		depths = append(depths, depth)
+		for _, child := range stackChildren(prs, p) {
+			walk(child, depth+1)
+		}
+	}
+	for _, p := range prs {
+		if _, ok := stackParent(prs, p); !ok {
+			walk(p, 0)
+		}
+	}
+	// PRs stacked in a cycle have no root; each cycle is listed as a tree
+	// under its first PR, which seen keeps from coming round again.
+	for _, p := range prs {
+		walk(p, 0)
+	}
+	return ordered, depths
+}
+
+// stackSchedules turns a stack (as returned by stackOf) into schedules: each
+// PR depends on the one it is based on and, once that merged, is retargeted
+// onto the base branch of the stack's root. Each schedule is pinned to its
+// PR's HeadSHA, which the caller looks up afresh with freshHeads.
+func stackSchedules(stack []pr, when time.Time, method mergeMethod) []scheduledMerge {
+	scheduled := make([]scheduledMerge, len(stack))
+	for i, p := range stack {
+		scheduled[i] = scheduledMerge{PR: p, When: when, MergeMethod: method, HeadSHA: p.HeadSHA}
+		if parent, ok := stackParent(stack[:i], p); ok {
+			scheduled[i].DependsOn = []dependency{{PR: parent}}
+			scheduled[i].RetargetTo = stack[0].BaseRef
+		}
+	}
+	return scheduled
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// stackedPR is a PR merging branch head into base.
+func stackedPR(number int, base, head string) pr {
+	p := testPR(number)
+	p.BaseRef, p.HeadRef = base, head
+	return p
+}
+
+func numbers(prs []pr) []int {
+	n := make([]int, len(prs))
+	for i, p := range prs {
+		n[i] = p.Number
+	}
+	return n
+}
+
+func TestStacks(t *testing.T) {
+	other := stackedPR(9, "a", "x")
+	other.Repo = "acme/other" // on a branch named like #1's, in another repository
+
+	tests := []struct {
+		name       string
+		prs        []pr
+		of         int // the PR to find the root and stack of
+		wantRoot   int
+		wantStack  []int // stackOf, bottom-up
+		wantTree   []int // stackTree
+		wantDepths []int
+	}{
+		{
+			name:       "linear",
+			prs:        []pr{stackedPR(3, "b", "c"), stackedPR(1, "main", "a"), stackedPR(2, "a", "b")},
+			of:         3,
+			wantRoot:   1,
+			wantStack:  []int{1, 2, 3},
+			wantTree:   []int{1, 2, 3},
+			wantDepths: []int{0, 1, 2},
+		},
+		{
+			name: "branching",
+			prs: []pr{
+				stackedPR(4, "b", "d"), stackedPR(5, "main", "e"), stackedPR(3, "a", "c"),
+				stackedPR(2, "a", "b"), stackedPR(1, "main", "a"), other,
+			},
+			of:         4,
+			wantRoot:   1,
+			wantStack:  []int{1, 3, 2, 4},
+			wantTree:   []int{5, 1, 3, 2, 4, 9},
+			wantDepths: []int{0, 0, 1, 1, 2, 0},
+		},
+		{
+			name:       "unstacked",
+			prs:        []pr{stackedPR(2, "main", "b"), stackedPR(1, "main", "a")},
+			of:         1,
+			wantRoot:   1,
+			wantStack:  []int{1},
+			wantTree:   []int{2, 1},
+			wantDepths: []int{0, 0},
+		},
+		{
+			name:       "cycle",
+			prs:        []pr{stackedPR(1, "b", "a"), stackedPR(2, "a", "b")},
+			of:         1,
+			wantRoot:   2,
+			wantStack:  []int{2, 1},
+			wantTree:   []int{1, 2},
+			wantDepths: []int{0, 1},
+		},
+		{
+			name:       "stacked on a cycle",
+			prs:        []pr{stackedPR(3, "a", "c"), stackedPR(1, "b", "a"), stackedPR(2, "a", "b"), stackedPR(4, "c", "d")},
+			of:         4,
+			wantRoot:   2,
+			wantStack:  []int{2, 1, 3, 4},
+			wantTree:   []int{3, 4, 1, 2},
+			wantDepths: []int{0, 1, 0, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := slices.IndexFunc(tt.prs, func(p pr) bool { return p.Repo == testRepo && p.Number == tt.of })
+			if got := stackRoot(tt.prs, tt.prs[i]); got.Number != tt.wantRoot {
+				t.Errorf("stackRoot(#%d) = #%d, want #%d", tt.of, got.Number, tt.wantRoot)
+			}
+			if got := numbers(stackOf(tt.prs, tt.prs[i])); !slices.Equal(got, tt.wantStack) {
+				t.Errorf("stackOf(#%d) = %v, want %v", tt.of, got, tt.wantStack)
+			}
+			ordered, depths := stackTree(tt.prs)
+			if got := numbers(ordered); !slices.Equal(got, tt.wantTree) || !slices.Equal(depths, tt.wantDepths) {
+				t.Errorf("stackTree = %v %v, want %v %v", got, depths, tt.wantTree, tt.wantDepths)
+			}
+		})
+	}
+}
+
+func TestStackSchedules(t *testing.T) {
+	when := time.Date(2026, 10, 14, 16, 0, 0, 0, time.UTC)
+	prs := []pr{stackedPR(1, "main", "a"), stackedPR(2, "a", "b"), stackedPR(3, "a", "c")}
+	prs[2].HeadSHA = "sha-3"
+	scheduled := stackSchedules(stackOf(prs, prs[2]), when, mergeMethodSquash)
+	if got := len(scheduled); got != 3 {
+		t.Fatalf("got %d schedules, want 3", got)
+	}
+	for _, s := range scheduled {
+		if !s.When.Equal(when) || s.MergeMethod != mergeMethodSquash {
+			t.Errorf("#%d is scheduled at %s with %s", s.PR.Number, s.When, s.MergeMethod)
+		}
+	}
+	if s := scheduled[0]; len(s.DependsOn) != 0 || s.RetargetTo != "" {
+		t.Errorf("the root depends on %v and is retargeted onto %q", s.DependsOn, s.RetargetTo)
+	}
+	for _, s := range scheduled[1:] {
+		if len(s.DependsOn) != 1 || s.DependsOn[0].PR.Number != 1 || s.RetargetTo != "main" {
+			t.Errorf("#%d depends on %v and is retargeted onto %q, want #1 and main", s.PR.Number, s.DependsOn, s.RetargetTo)
+		}
+	}
+	if got := scheduled[2].HeadSHA; got != "sha-3" {
+		t.Errorf("HeadSHA = %q, want the listed sha-3", got)
+	}
+}
+
+func TestFreshHeads(t *testing.T) {
+	prs := []pr{stackedPR(1, "main", "a"), stackedPR(2, "a", "b")}
+	prs[0].HeadSHA, prs[1].HeadSHA = "listed-1", "listed-2"
+	gh := newFakeGitHub("alice", testRepo, prs...)
+	gh.setHeadSHA(2, "pushed-2")
+	github := func(string) GitHub { return gh }
+
+	fresh, err := freshHeads(github, prs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheduled := stackSchedules(fresh, time.Time{}, mergeMethodMerge)
+	if scheduled[0].HeadSHA != "sha-1" || scheduled[1].HeadSHA != "pushed-2" {
+		t.Errorf("pinned to %q and %q, want the current sha-1 and pushed-2", scheduled[0].HeadSHA, scheduled[1].HeadSHA)
+	}
+	if prs[1].HeadSHA != "listed-2" {
+		t.Error("freshHeads changed the listed PRs")
+	}
+
+	gh.failNext("HeadSHA", errors.New("HTTP 502"))
+	if _, err := freshHeads(github, prs); err == nil {
+		t.Error("scheduled without a head commit after a failed lookup")
+	}
+	gh.setHeadSHA(2, "")
+	if _, err := freshHeads(github, prs); err == nil {
+		t.Error("scheduled without a head commit")
+	}
+}
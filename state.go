@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// ---------- Schedule states ----------
+
+// scheduleState is where a schedule is in its lifecycle. It only moves along
+// scheduleTransitions, through scheduledMerge.transition.
+type scheduleState string
+
+const (
+	stateNew scheduleState = "" // not added to the state file yet
+	// statePending waits for the merge time, its dependencies, checks or a
+	// re-confirmation.
+	statePending       scheduleState = "pending"
+	stateCommenting    scheduleState = "commenting"     // posting the pre-merge comment
+	stateMerging       scheduleState = "merging"        // enabling auto-merge, retries included
+	stateAwaitingMerge scheduleState = "awaiting_merge" // auto-merge set, next check at CheckAt
+	// stateVerifying checks whether the PR merged, updating its branch if it
+	// is behind, or reports that it did not.
+	stateVerifying scheduleState = "verifying"
+	stateMerged    scheduleState = "merged"
+	stateFailed    scheduleState = "failed"
+	stateCancelled scheduleState = "cancelled"
+)
+
+// scheduleTransitions lists the states each state may move to. Merged, failed
+// and cancelled are final; a schedule may fail or be cancelled in any other.
+// A dry run is merged as soon as it would have set auto-merge, and a merge
+// whose head moved under it goes back to pending, to go on to merging without
+// a second pre-merge comment once re-confirmed.
+var scheduleTransitions = map[scheduleState][]scheduleState{
+	stateNew:           {statePending},
+	statePending:       {stateCommenting, stateMerging, stateMerged, stateFailed, stateCancelled},
+	stateCommenting:    {stateMerging, stateFailed, stateCancelled},
+	stateMerging:       {statePending, stateAwaitingMerge, stateMerged, stateFailed, stateCancelled},
+	stateAwaitingMerge: {stateVerifying, stateFailed, stateCancelled},
+	stateVerifying:     {stateAwaitingMerge, stateMerged, stateFailed, stateCancelled},
+}
+
+// final reports whether the schedule has ended.
+func (st scheduleState) final() bool {
+	return st == stateMerged || st == stateFailed || st == stateCancelled
+}
+
+// transition moves s to another state, with message as its LastMessage, and
+// records the move in its history. A move the table does not allow is refused,
+// recorded as such, and leaves the state as it was.
+func (s *scheduledMerge) transition(now time.Time, to scheduleState, message string) bool {
+	from := s.State
+	if !slices.Contains(scheduleTransitions[from], to) {
+		s.record(now, fmt.Sprintf("Refused to move from %s to %s: %s", from, to, message))
+		return false
+	}
+	s.State = to
+	s.LastMessage = message
+	s.History = append(s.History, historyEntry{At: now, Event: message, From: from, To: to})
+	if to.final() {
+		s.FinishedAt = now
+	}
+	return true
+}
+
+// done reports whether the schedule has ended.
+func (s scheduledMerge) done() bool { return s.State.final() }
+
+// verifying reports whether auto-merge is set and the merge being verified.
+func (s scheduledMerge) verifying() bool {
+	return s.State == stateAwaitingMerge || s.State == stateVerifying
+}
+
+// autoMergeRequested reports whether auto-merge was (or is being) enabled on
+// GitHub, so it has to be disabled again when the schedule is cancelled.
+func (s scheduledMerge) autoMergeRequested() bool {
+	return s.State == stateMerging || s.verifying()
+}
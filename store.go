@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// ---------- Persistence ----------
+
+const (
+	stateFileName = "schedules.json"
+	lockFileName  = "schedules.lock"
+
+	// How long finished schedules stay in the state file so clients can still
+	// show their outcome.
+	finishedRetention = 24 * time.Hour
+)
+
+// stateDir returns the directory holding the scheduler state, following the
+// XDG base directory spec ($XDG_STATE_HOME, defaulting to ~/.local/state).
+func stateDir() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "pr-scheduler"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate home directory: %w", err)
+	}
+	return filepath.Join(home, ".local", "state", "pr-scheduler"), nil
+}
+
+// statePath returns the path of a file in the state directory, creating the
+// directory if needed.
+func statePath(name string) (string, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create state directory: %w", err)
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// loadSchedules reads the persisted schedules. A missing state file is not an
+// error: it simply means nothing was scheduled yet.
+func loadSchedules() ([]scheduledMerge, error) {
+	path, err := statePath(stateFileName)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return []scheduledMerge{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	var scheduled []scheduledMerge
+	if err := json.Unmarshal(data, &scheduled); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", path, err)
+	}
+	return scheduled, nil
+}
+
+// schedulesModTime returns when the state file was last written, the zero
+// time while there is none.
+func schedulesModTime() (time.Time, error) {
+	path, err := statePath(stateFileName)
+	if err != nil {
+		return time.Time{}, err
+	}
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read state file: %w", err)
+	}
+	return info.ModTime(), nil
+}
+
+func encodeSchedules(scheduled []scheduledMerge, now time.Time) ([]byte, error) {
+	kept := make([]scheduledMerge, 0, len(scheduled))
+	for _, s := range scheduled {
+		if !s.done() || now.Sub(s.FinishedAt) < finishedRetention {
+			kept = append(kept, s)
+		}
+	}
+	data, err := json.MarshalIndent(kept, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode state: %w", err)
+	}
+	return data, nil
+}
+
+// saveSchedules writes the schedules, dropping the ones that finished long
+// ago so the file does not grow forever. The file is replaced atomically so a
+// crash mid-write never leaves a truncated state behind.
+func saveSchedules(scheduled []scheduledMerge) error {
+	path, err := statePath(stateFileName)
+	if err != nil {
+		return err
+	}
+	data, err := encodeSchedules(scheduled, time.Now())
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to replace state file: %w", err)
+	}
+	return nil
+}
+
+// lockFile takes an exclusive flock on a file in the state directory. With
+// nonBlocking set it fails with syscall.EWOULDBLOCK instead of waiting.
+func lockFile(name string, nonBlocking bool) (release func(), err error) {
+	path, err := statePath(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+	how := syscall.LOCK_EX
+	if nonBlocking {
+		how |= syscall.LOCK_NB
+	}
+	if err := syscall.Flock(int(f.Fd()), how); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// updateSchedules loads the schedules under an exclusive lock, lets fn modify
+// them and writes the result back. This is how the daemon and its clients
+// share the state file without clobbering each other's changes. Returning an
+// error from fn aborts the update.
+func updateSchedules(fn func(scheduled []scheduledMerge) ([]scheduledMerge, error)) error {
+	release, err := lockFile(lockFileName, false)
+	if err != nil {
+		return fmt.Errorf("failed to lock state file: %w", err)
+	}
+	defer release()
+
+	scheduled, err := loadSchedules()
+	if err != nil {
+		return err
+	}
+	before, err := encodeSchedules(scheduled, time.Now())
+	if err != nil {
+		return err
+	}
+
+	scheduled, err = fn(scheduled)
+	if err != nil {
+		return err
+	}
+
+	after, err := encodeSchedules(scheduled, time.Now())
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(before, after) {
+		return nil
+	}
+	return saveSchedules(scheduled)
+}
+
+// addSchedule appends a new schedule, refusing a second active one for the
+// same PR.
+func addSchedule(s scheduledMerge) error {
+	return addSchedules([]scheduledMerge{s})
+}
+
+// addSchedules appends several schedules at once, e.g. a whole stack. Either
+// all of them are added or, if one PR already has an active schedule, none.
+func addSchedules(added []scheduledMerge) error {
+	err := updateSchedules(func(scheduled []scheduledMerge) ([]scheduledMerge, error) {
+		for _, s := range added {
+			if findScheduled(scheduled, s.PR.Repo, s.PR.Number) >= 0 {
+				return nil, fmt.Errorf("PR %s already has a scheduled merge", s.PR.ref())
+			}
+		}
+		now := time.Now()
+		for _, s := range added {
+			message := s.LastMessage
+			if message == "" {
+				message = "Scheduled for " + s.When.Format("2006-01-02 15:04")
+			}
+			s.transition(now, statePending, message)
+			s.notify(eventScheduled)
+			scheduled = append(scheduled, s)
+		}
+		return scheduled, nil
+	})
+	if err == nil {
+		for _, s := range added {
+			audit.recordSchedule("schedule.created", s, fmt.Sprintf("%s at %s", s.MergeMethod.label(), s.When.Format(time.RFC3339)))
+		}
+	}
+	return err
+}
+
+// cancelSchedule marks the active schedule of a PR as cancelled and returns
+// it as it was before, so the caller can switch GitHub auto-merge off again if
+// the schedule already enabled it. found is false when the PR has no active
+// schedule.
+func cancelSchedule(repo string, number int, now time.Time) (cancelled scheduledMerge, found bool, err error) {
+	err = updateSchedules(func(scheduled []scheduledMerge) ([]scheduledMerge, error) {
+		idx := findScheduled(scheduled, repo, number)
+		if idx < 0 {
+			return scheduled, nil
+		}
+		found = true
+		cancelled = scheduled[idx]
+		scheduled[idx].cancel(now, "Cancelled")
+		return scheduled, nil
+	})
+	if err == nil && found {
+		audit.recordSchedule("schedule.cancelled", cancelled, "")
+	}
+	return cancelled, found, err
+}
+
+// rescheduleSchedule moves the active schedule of a PR to a new time, with an
+// optional message explaining the move. Only schedules that have not started
+// merging yet can be moved; a gated one waits for its checks afresh.
+func rescheduleSchedule(repo string, number int, when time.Time, message string) error {
+	var moved scheduledMerge
+	err := updateSchedules(func(scheduled []scheduledMerge) ([]scheduledMerge, error) {
+		idx := findScheduled(scheduled, repo, number)
+		if idx < 0 {
+			return nil, fmt.Errorf("no active scheduled merge for PR %s#%d", repo, number)
+		}
+		if scheduled[idx].State != statePending {
+			return nil, fmt.Errorf("PR %s#%d is already being merged", repo, number)
+		}
+		scheduled[idx].moveTo(when)
+		scheduled[idx].LastMessage = message
+		moved = scheduled[idx]
+		return scheduled, nil
+	})
+	if err == nil {
+		detail := "to " + when.Format(time.RFC3339)
+		if message != "" {
+			detail += ": " + message
+		}
+		audit.recordSchedule("schedule.rescheduled", moved, detail)
+	}
+	return err
+}
+
+// confirmHead accepts the commits pushed to a PR since its schedule was
+// confirmed: the merge goes ahead with the new head, once the daemon made
+// sure nothing was pushed since.
+func confirmHead(repo string, number int, now time.Time) (confirmed scheduledMerge, err error) {
+	err = updateSchedules(func(scheduled []scheduledMerge) ([]scheduledMerge, error) {
+		idx := findScheduled(scheduled, repo, number)
+		if idx < 0 {
+			return nil, fmt.Errorf("no active scheduled merge for PR %s#%d", repo, number)
+		}
+		s := &scheduled[idx]
+		if s.NewHeadSHA == "" {
+			return nil, fmt.Errorf("PR %s#%d does not need re-confirmation", repo, number)
+		}
+		s.record(now, fmt.Sprintf("Re-confirmed at %s (was %s)", shortSHA(s.NewHeadSHA), shortSHA(s.HeadSHA)))
+		s.HeadSHA = s.NewHeadSHA
+		s.NewHeadSHA = ""
+		s.HeadVerified = false
+		s.LastMessage = "Re-confirmed at " + shortSHA(s.HeadSHA)
+		confirmed = *s
+		return scheduled, nil
+	})
+	if err == nil {
+		audit.recordSchedule("schedule.confirmed", confirmed, confirmed.HeadSHA)
+	}
+	return confirmed, err
+}
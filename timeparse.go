@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---------- Time parsing ----------
+
+// parseScheduleTime turns user input into a merge time, in local time. It
+// accepts:
+//
+//	now                      (or nothing)
+//	2026-10-17 09:00         an absolute date and time
+//	+90m, +1h30m, +2d        relative to now ("in 90m" works too)
+//	17:30, 9am, 4:15pm       today, or tomorrow if that time has passed
+//	tomorrow 9am, today 18:00
+//	fri 16:00, friday 4pm    the next such day, today included if still ahead
+//	next monday 10:00        the next such day, never today
+//	2026-10-17 9am           a date with any of the time forms above
+func parseScheduleTime(raw string, now time.Time) (time.Time, error) {
+	s := strings.ToLower(strings.Join(strings.Fields(raw), " "))
+	if s == "" || s == "now" {
+		return now, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04", s, time.Local); err == nil {
+		return t, nil
+	}
+	if rest, ok := strings.CutPrefix(s, "+"); ok {
+		return parseRelativeTime(rest, now)
+	}
+	if rest, ok := strings.CutPrefix(s, "in "); ok {
+		return parseRelativeTime(rest, now)
+	}
+
+	words := strings.Fields(s)
+	var day string // "", "today", "tomorrow", "next <weekday>", a weekday or a date
+	switch {
+	case words[0] == "next" && len(words) > 1:
+		day, words = "next "+words[1], words[2:]
+	case words[0] == "today" || words[0] == "tomorrow" || isWeekday(words[0]) || isDate(words[0]):
+		day, words = words[0], words[1:]
+	}
+	if len(words) > 0 && words[0] == "at" {
+		words = words[1:]
+	}
+	if len(words) == 0 {
+		return time.Time{}, fmt.Errorf("missing time of day in %q, e.g. %q", raw, strings.TrimSpace(s+" 9am"))
+	}
+	hour, minute, err := parseTimeOfDay(strings.Join(words, ""))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	now = now.In(time.Local)
+	at := func(d time.Time) time.Time {
+		return time.Date(d.Year(), d.Month(), d.Day(), hour, minute, 0, 0, time.Local)
+	}
+	switch {
+	case day == "":
+		t := at(now)
+		if !t.After(now) {
+			t = at(now.AddDate(0, 0, 1))
+		}
+		return t, nil
+	case day == "today":
+		return at(now), nil
+	case day == "tomorrow":
+		return at(now.AddDate(0, 0, 1)), nil
+	case isDate(day):
+		d, err := time.ParseInLocation("2006-01-02", day, time.Local)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid date %q", day)
+		}
+		return at(d), nil
+	}
+
+	name, next := strings.CutPrefix(day, "next ")
+	wd, ok := weekdays[name]
+	if !ok {
+		return time.Time{}, fmt.Errorf("unknown day %q", name)
+	}
+	days := (int(wd) - int(now.Weekday()) + 7) % 7
+	t := at(now.AddDate(0, 0, days))
+	if days == 0 && (next || !t.After(now)) {
+		t = at(now.AddDate(0, 0, 7))
+	}
+	return t, nil
+}
+
+var relativeDaysRe = regexp.MustCompile(`^(\d+)d(.*)$`)
+
+// parseRelativeTime parses durations like "90m", "1h30m" or "2d".
+func parseRelativeTime(s string, now time.Time) (time.Time, error) {
+	s = strings.ReplaceAll(s, " ", "")
+	var days int
+	if m := relativeDaysRe.FindStringSubmatch(s); m != nil {
+		days, _ = strconv.Atoi(m[1])
+		s = m[2]
+	}
+	var d time.Duration
+	if s != "" {
+		var err error
+		if d, err = time.ParseDuration(s); err != nil || d < 0 {
+			return time.Time{}, fmt.Errorf("invalid duration %q, e.g. +90m, +1h30m or +2d", s)
+		}
+	}
+	return now.AddDate(0, 0, days).Add(d), nil
+}
+
+// parseLogTime parses a bound of `pr-scheduler log --since/--until`: a
+// duration back from now ("90m", "2d"), "today", "yesterday", a date
+// ("2026-10-17", at midnight) or a date and time ("2026-10-17 09:00").
+func parseLogTime(raw string, now time.Time) (time.Time, error) {
+	s := strings.ToLower(strings.Join(strings.Fields(raw), " "))
+	now = now.In(time.Local)
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	switch s {
+	case "today":
+		return midnight, nil
+	case "yesterday":
+		return midnight.AddDate(0, 0, -1), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04", s, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, strings.ToUpper(s)); err == nil {
+		return t, nil
+	}
+	ago, err := parseRelativeTime(s, now)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, e.g. 2h, 3d, today or 2026-10-17 09:00", raw)
+	}
+	return now.Add(-ago.Sub(now)), nil
+}
+
+var timeOfDayRe = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?(am|pm)?$`)
+
+// parseTimeOfDay parses "17:30", "9am", "4:15pm" or "noon".
+func parseTimeOfDay(s string) (hour, minute int, err error) {
+	switch s {
+	case "noon":
+		return 12, 0, nil
+	case "midnight":
+		return 0, 0, nil
+	}
+	m := timeOfDayRe.FindStringSubmatch(s)
+	if m == nil {
+		return 0, 0, fmt.Errorf("invalid time of day %q, e.g. 17:30 or 9am", s)
+	}
+	hour, _ = strconv.Atoi(m[1])
+	if m[2] != "" {
+		minute, _ = strconv.Atoi(m[2])
+	}
+	switch m[3] {
+	case "":
+		if m[2] == "" {
+			return 0, 0, fmt.Errorf("ambiguous time %q, use 24h HH:MM or am/pm", s)
+		}
+	case "am", "pm":
+		if hour < 1 || hour > 12 {
+			return 0, 0, fmt.Errorf("invalid time of day %q", s)
+		}
+		hour %= 12
+		if m[3] == "pm" {
+			hour += 12
+		}
+	}
+	if hour > 23 || minute > 59 {
+		return 0, 0, fmt.Errorf("invalid time of day %q", s)
+	}
+	return hour, minute, nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tues": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thurs": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+func isWeekday(s string) bool {
+	_, ok := weekdays[s]
+	return ok
+}
+
+var dateRe = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+
+func isDate(s string) bool { return dateRe.MatchString(s) }
+
+// describeScheduleTime renders a resolved merge time for the input preview,
+// e.g. "Fri 2026-10-17 16:00 (in 1d 2h)".
+func describeScheduleTime(t, now time.Time) string {
+	abs := t.Format("Mon 2006-01-02 15:04")
+	d := t.Sub(now).Round(time.Minute)
+	if d <= 0 {
+		return abs + " (now)"
+	}
+	days := int(d / (24 * time.Hour))
+	d -= time.Duration(days) * 24 * time.Hour
+	var parts []string
+	if days > 0 {
+		parts = append(parts, fmt.Sprintf("%dd", days))
+	}
+	if h := int(d / time.Hour); h > 0 {
+		parts = append(parts, fmt.Sprintf("%dh", h))
+	}
+	if mins := int(d % time.Hour / time.Minute); mins > 0 {
+		parts = append(parts, fmt.Sprintf("%dm", mins))
+	}
+	return fmt.Sprintf("%s (in %s)", abs, strings.Join(parts, " "))
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// parseNow is a Wednesday afternoon.
+var parseNow = time.Date(2026, 10, 14, 15, 30, 0, 0, time.Local)
+
+func localTime(year int, month time.Month, day, hour, minute int) time.Time {
+	return time.Date(year, month, day, hour, minute, 0, 0, time.Local)
+}
+
+func TestParseScheduleTime(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{in: "", want: parseNow},
+		{in: "now", want: parseNow},
+		{in: "2026-10-17 09:00", want: localTime(2026, 10, 17, 9, 0)},
+		{in: "2026-10-17 9am", want: localTime(2026, 10, 17, 9, 0)},
+		{in: "+90m", want: parseNow.Add(90 * time.Minute)},
+		{in: "in 2h", want: parseNow.Add(2 * time.Hour)},
+		{in: "+1d2h", want: parseNow.AddDate(0, 0, 1).Add(2 * time.Hour)},
+		{in: "17:30", want: localTime(2026, 10, 14, 17, 30)},
+		// Already past today: tomorrow.
+		{in: "9am", want: localTime(2026, 10, 15, 9, 0)},
+		{in: "15:30", want: localTime(2026, 10, 15, 15, 30)},
+		{in: "tomorrow 9am", want: localTime(2026, 10, 15, 9, 0)},
+		{in: "Tomorrow  at 9AM", want: localTime(2026, 10, 15, 9, 0)},
+		// "today" is taken literally, even when that time has passed.
+		{in: "today 09:00", want: localTime(2026, 10, 14, 9, 0)},
+		{in: "today 6pm", want: localTime(2026, 10, 14, 18, 0)},
+		{in: "fri 16:00", want: localTime(2026, 10, 16, 16, 0)},
+		{in: "friday 4pm", want: localTime(2026, 10, 16, 16, 0)},
+		// Across the weekend into the next week.
+		{in: "mon 10:00", want: localTime(2026, 10, 19, 10, 0)},
+		{in: "tue 10:00", want: localTime(2026, 10, 20, 10, 0)},
+		// Today's weekday: today if still ahead, else a week later.
+		{in: "wed 16:00", want: localTime(2026, 10, 14, 16, 0)},
+		{in: "wed 9am", want: localTime(2026, 10, 21, 9, 0)},
+		{in: "next wed 16:00", want: localTime(2026, 10, 21, 16, 0)},
+		{in: "next monday 10:00", want: localTime(2026, 10, 19, 10, 0)},
+		{in: "noon", want: localTime(2026, 10, 15, 12, 0)},
+		{in: "tomorrow midnight", want: localTime(2026, 10, 15, 0, 0)},
+		{in: "tomorrow", wantErr: true},
+		{in: "tomorrow 9", wantErr: true},
+		{in: "next 9am", wantErr: true},
+		{in: "someday", wantErr: true},
+		{in: "+soon", wantErr: true},
+		{in: "2026-13-01 9am", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseScheduleTime(tt.in, parseNow)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseScheduleTime(%q) = %s, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("parseScheduleTime(%q) = %s, %v, want %s", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseRelativeTime(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{in: "90m", want: parseNow.Add(90 * time.Minute)},
+		{in: "1h30m", want: parseNow.Add(90 * time.Minute)},
+		{in: "2h", want: parseNow.Add(2 * time.Hour)},
+		{in: "2d", want: parseNow.AddDate(0, 0, 2)},
+		{in: "1d 12h", want: parseNow.AddDate(0, 0, 1).Add(12 * time.Hour)},
+		{in: "-1h", wantErr: true},
+		{in: "2 weeks", wantErr: true},
+		{in: "h", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseRelativeTime(tt.in, parseNow)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseRelativeTime(%q) = %s, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("parseRelativeTime(%q) = %s, %v, want %s", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseTimeOfDay(t *testing.T) {
+	tests := []struct {
+		in           string
+		hour, minute int
+		wantErr      bool
+	}{
+		{in: "17:30", hour: 17, minute: 30},
+		{in: "0:05", hour: 0, minute: 5},
+		{in: "9am", hour: 9},
+		{in: "4:15pm", hour: 16, minute: 15},
+		{in: "12am", hour: 0},
+		{in: "12:30am", hour: 0, minute: 30},
+		{in: "12pm", hour: 12},
+		{in: "noon", hour: 12},
+		{in: "midnight", hour: 0},
+		{in: "9", wantErr: true}, // ambiguous
+		{in: "13pm", wantErr: true},
+		{in: "0am", wantErr: true},
+		{in: "24:00", wantErr: true},
+		{in: "9:60", wantErr: true},
+		{in: "9.30", wantErr: true},
+	}
+	for _, tt := range tests {
+		hour, minute, err := parseTimeOfDay(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseTimeOfDay(%q) = %d:%02d, want an error", tt.in, hour, minute)
+			}
+			continue
+		}
+		if err != nil || hour != tt.hour || minute != tt.minute {
+			t.Errorf("parseTimeOfDay(%q) = %d:%02d, %v, want %d:%02d", tt.in, hour, minute, err, tt.hour, tt.minute)
+		}
+	}
+}
+
+func TestDescribeScheduleTime(t *testing.T) {
+	tests := []struct {
+		t    time.Time
+		want string
+	}{
+		{parseNow, "Wed 2026-10-14 15:30 (now)"},
+		{parseNow.Add(-time.Hour), "Wed 2026-10-14 14:30 (now)"},
+		{parseNow.Add(90 * time.Minute), "Wed 2026-10-14 17:00 (in 1h 30m)"},
+		{parseNow.Add(2 * time.Hour), "Wed 2026-10-14 17:30 (in 2h)"},
+		{localTime(2026, 10, 16, 16, 0), "Fri 2026-10-16 16:00 (in 2d 30m)"},
+		{parseNow.AddDate(0, 0, 1), "Thu 2026-10-15 15:30 (in 1d)"},
+	}
+	for _, tt := range tests {
+		if got := describeScheduleTime(tt.t, parseNow); got != tt.want {
+			t.Errorf("describeScheduleTime(%s) = %q, want %q", tt.t, got, tt.want)
+		}
+	}
+}